@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/peethree/chirpy/internal/database"
+)
+
+// one-off commands run instead of the server: chirpy <command> [flags]
+func (cfg *apiConfig) runCommand(args []string) error {
+	switch args[0] {
+	case "create-admin":
+		return cfg.createAdminCommand(args[1:])
+	}
+
+	return fmt.Errorf("unknown command %q, the only command is create-admin", args[0])
+}
+
+// makes a user an admin, creating the user if the email address has no account yet.
+// The password of a new user comes from CHIRPY_ADMIN_PASSWORD or the first line on stdin, never from a flag,
+// so it doesn't end up in the shell history or the process list.
+func (cfg *apiConfig) createAdminCommand(args []string) error {
+	flags := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	email := flags.String("email", "", "email address of the admin")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if !validEmail(*email) {
+		return errors.New("create-admin needs -email with a plain address like admin@example.com")
+	}
+
+	ctx := context.Background()
+
+	user, err := cfg.db.FindEmail(ctx, *email)
+	if errors.Is(err, sql.ErrNoRows) {
+		user, err = cfg.createAdminUser(ctx, *email)
+	}
+	if err != nil {
+		return err
+	}
+
+	user, err = cfg.db.UpdateUserRole(ctx, database.UpdateUserRoleParams{
+		Role: roleAdmin,
+		ID:   user.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s (%s) is an admin now\n", user.Email, user.ID)
+	return nil
+}
+
+// a new user with a verified address, the operator vouches for it
+func (cfg *apiConfig) createAdminUser(ctx context.Context, email string) (database.User, error) {
+	password := os.Getenv("CHIRPY_ADMIN_PASSWORD")
+	if password == "" {
+		fmt.Fprintf(os.Stderr, "No account for %s yet, enter a password for it: ", email)
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return database.User{}, fmt.Errorf("reading password: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	// same rules as signing up
+	err := cfg.passwordPolicy.Check(password, email)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	hashedPassword, err := cfg.passwords.Hash(password)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	user, err := cfg.db.CreateUser(ctx, database.CreateUserParams{
+		Email:          email,
+		HashedPassword: hashedPassword,
+		Username:       defaultUsername(),
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	_, err = cfg.db.VerifyEmail(ctx, database.VerifyEmailParams{
+		ID:    user.ID,
+		Email: user.Email,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	return user, nil
+}
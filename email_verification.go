@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/peethree/chirpy/internal/database"
+	"github.com/peethree/chirpy/internal/mailer"
+)
+
+// verification links are signed tokens with this purpose, valid for a day
+const (
+	verifyEmailPurpose = "verify_email"
+	verifyEmailTTL     = 24 * time.Hour
+)
+
+// a bare address like user@example.com, no display name or comments
+func validEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email
+}
+
+// mails a link that verifies the address for the user, the link names the address so it can't verify another one
+func (cfg *apiConfig) sendVerificationEmail(userID uuid.UUID, email string) error {
+	token, err := cfg.keys.MakePurposeJWT(verifyEmailPurpose, userID, email, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/users/verify-email?token=%s", cfg.publicURL, url.QueryEscape(token))
+	cfg.sendMail(mailer.Message{
+		To:      email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf("Open this link to verify your email address, it expires in %s:\n%s\n\n"+
+			"If you didn't sign up for Chirpy or change your address, ignore this email.\n", verifyEmailTTL, link),
+	})
+
+	return nil
+}
+
+// the link from the verification email, verifies the address or swaps in the pending one
+func (cfg *apiConfig) verifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	claims, err := cfg.keys.ValidatePurposeJWT(r.URL.Query().Get("token"), verifyEmailPurpose)
+	if err != nil {
+		http.Error(w, "Verification link is invalid or expired", 400)
+		return
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		http.Error(w, "Verification link is invalid or expired", 400)
+		return
+	}
+
+	// a pending address first, it only exists if the user asked for the change
+	confirmed, err := cfg.db.ConfirmPendingEmail(r.Context(), database.ConfirmPendingEmailParams{
+		ID:           userID,
+		PendingEmail: nullString(&claims.Email),
+	})
+	if err != nil && isUniqueViolation(err) {
+		http.Error(w, "Email address is in use already", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error confirming email: %s", err)
+		http.Error(w, "Unable to verify email address", 500)
+		return
+	}
+
+	if confirmed == 0 {
+		verified, err := cfg.db.VerifyEmail(r.Context(), database.VerifyEmailParams{
+			ID:    userID,
+			Email: claims.Email,
+		})
+		if err != nil {
+			log.Printf("Error verifying email: %s", err)
+			http.Error(w, "Unable to verify email address", 500)
+			return
+		}
+		// the address changed since the link was sent
+		if verified == 0 {
+			http.Error(w, "Verification link is outdated", 400)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Email address verified"))
+}
+
+// sends the verification email again, for the pending address if there is one
+func (cfg *apiConfig) resendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := cfg.authenticate(w, r, scopeProfileWrite)
+	if !ok {
+		return
+	}
+	userID := c.userID
+
+	user, err := cfg.db.FindUserById(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Unable to find user", 404)
+		return
+	}
+
+	email := user.Email
+	if user.PendingEmail.Valid {
+		email = user.PendingEmail.String
+	} else if user.EmailVerifiedAt.Valid {
+		http.Error(w, "Email address is already verified", 400)
+		return
+	}
+
+	err = cfg.sendVerificationEmail(user.ID, email)
+	if err != nil {
+		log.Printf("Error sending verification email: %s", err)
+		http.Error(w, "Unable to send verification email", 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// with REQUIRE_VERIFIED_EMAIL set, only users with a verified address may post
+func (cfg *apiConfig) mayPost(ctx context.Context, userID uuid.UUID) (bool, error) {
+	if !cfg.requireVerifiedEmail {
+		return true, nil
+	}
+
+	user, err := cfg.db.FindUserById(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return user.EmailVerifiedAt.Valid, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/peethree/chirpy/internal/database"
+)
+
+// follows a user, following them again changes nothing
+func (cfg *apiConfig) followUserHandler(w http.ResponseWriter, r *http.Request) {
+	followerID, followeeID, ok := cfg.followRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.FollowUser(r.Context(), database.FollowUserParams{
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		log.Printf("Error following user: %s", err)
+		http.Error(w, "Unable to follow user", 500)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// unfollows a user, unfollowing someone you don't follow changes nothing
+func (cfg *apiConfig) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	followerID, followeeID, ok := cfg.followRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		log.Printf("Error unfollowing user: %s", err)
+		http.Error(w, "Unable to unfollow user", 500)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// shared checks for following and unfollowing: a valid jwt and an existing user other than yourself
+// writes the error response itself and returns false when a check fails
+func (cfg *apiConfig) followRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	c, ok := cfg.authenticate(w, r, scopeFollowsWrite)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	followerID := c.userID
+
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		http.Error(w, "Unable to find user", 404)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	if followeeID == followerID {
+		http.Error(w, "Can't follow yourself", 400)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	_, err = cfg.db.FindUserById(r.Context(), followeeID)
+	if err != nil {
+		http.Error(w, "Unable to find user", 404)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return followerID, followeeID, true
+}
+
+// home timeline: chirps by the user and the accounts they follow, newest first
+func (cfg *apiConfig) timelineHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := cfg.authenticate(w, r, scopeTimelineRead)
+	if !ok {
+		return
+	}
+	userID := c.userID
+
+	page, err := parsePageParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	cursorCreatedAt, cursorID := page.cursorArgs()
+
+	timeline, err := cfg.db.LoadTimeline(r.Context(), database.LoadTimelineParams{
+		UserID:          userID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		log.Printf("Error loading timeline: %s", err)
+		http.Error(w, "Can't load timeline", 500)
+		return
+	}
+
+	timeline, next := paginate(timeline, page.Limit, func(chirp database.LoadTimelineRow) pageCursor {
+		return pageCursor{CreatedAt: chirp.CreatedAt, ID: chirp.ID}
+	})
+
+	viewer := uuid.NullUUID{UUID: userID, Valid: true}
+	response := []responseChirp{}
+	for _, chirp := range timeline {
+		response = append(response, likedChirpResponse(loadedChirp(chirp), viewer))
+	}
+
+	err = cfg.hydrateChirps(r.Context(), chirpRefs(response), viewer)
+	if err != nil {
+		log.Printf("Error loading original chirps: %s", err)
+		http.Error(w, "Can't load timeline", 500)
+		return
+	}
+
+	setNextPageLink(w, r, next)
+	encodeJSON(w, response, 200)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/peethree/chirpy/internal/database"
+)
+
+// longest tag we index, and the defaults for GET /api/hashtags/trending
+const (
+	maxHashtagLength     = 50
+	defaultTrendingLimit = 10
+	maxTrendingLimit     = 50
+)
+
+// struct for responding to api/hashtags/trending
+type responseTrendingHashtag struct {
+	Tag   string  `json:"tag"`
+	Uses  int64   `json:"uses"`
+	Score float64 `json:"score"`
+}
+
+// finds #tags in a chirp body, lowercased, without the # and without duplicates
+// a tag has to start at the beginning of the body or after a non-word character (so no foo#bar),
+// runs over letters, digits and underscores, and needs at least one letter (so no #1)
+func extractHashtags(body string) []string {
+	var tags []string
+	seen := map[string]bool{}
+
+	isTagRune := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+	}
+
+	for i := 0; i < len(body); i++ {
+		if body[i] != '#' {
+			continue
+		}
+		if i > 0 {
+			previous, _ := utf8.DecodeLastRuneInString(body[:i])
+			if isTagRune(previous) {
+				continue
+			}
+		}
+
+		end := i + 1
+		hasLetter := false
+		for end < len(body) {
+			r, size := utf8.DecodeRuneInString(body[end:])
+			if !isTagRune(r) {
+				break
+			}
+			hasLetter = hasLetter || unicode.IsLetter(r)
+			end += size
+		}
+
+		tag := strings.ToLower(body[i+1 : end])
+		i = end - 1
+		if !hasLetter || utf8.RuneCountInString(tag) > maxHashtagLength || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+// (re)links a chirp to the hashtags in its body, creating tags that don't exist yet
+func (cfg *apiConfig) tagChirp(ctx context.Context, chirp database.Chirp) error {
+	err := cfg.db.UntagChirp(ctx, chirp.ID)
+	if err != nil {
+		return err
+	}
+
+	tags := extractHashtags(chirp.Body)
+	if len(tags) == 0 {
+		return nil
+	}
+
+	err = cfg.db.CreateHashtags(ctx, tags)
+	if err != nil {
+		return err
+	}
+
+	return cfg.db.TagChirp(ctx, database.TagChirpParams{
+		ChirpID:   chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		Tags:      tags,
+	})
+}
+
+// chirps using a hashtag, newest first
+func (cfg *apiConfig) hashtagChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	// same normalization as extractHashtags, a leading # is optional
+	tag := strings.ToLower(strings.TrimPrefix(r.PathValue("tag"), "#"))
+	if tag == "" {
+		http.Error(w, "hashtag is required", 400)
+		return
+	}
+
+	page, err := parsePageParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	cursorCreatedAt, cursorID := page.cursorArgs()
+
+	viewer := cfg.optionalViewer(r)
+
+	chirps, err := cfg.db.LoadHashtagChirps(r.Context(), database.LoadHashtagChirpsParams{
+		ViewerID:        viewer,
+		Tag:             tag,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		log.Printf("Error loading hashtag chirps: %s", err)
+		http.Error(w, "Can't load chirps", 500)
+		return
+	}
+
+	chirps, next := paginate(chirps, page.Limit, func(chirp database.LoadHashtagChirpsRow) pageCursor {
+		return pageCursor{CreatedAt: chirp.CreatedAt, ID: chirp.ID}
+	})
+
+	response := []responseChirp{}
+	for _, chirp := range chirps {
+		response = append(response, likedChirpResponse(loadedChirp(chirp), viewer))
+	}
+
+	err = cfg.hydrateChirps(r.Context(), chirpRefs(response), viewer)
+	if err != nil {
+		log.Printf("Error loading original chirps: %s", err)
+		http.Error(w, "Can't load chirps", 500)
+		return
+	}
+
+	setNextPageLink(w, r, next)
+	encodeJSON(w, response, 200)
+}
+
+// hashtags used most within the trending window, recent uses weigh more
+func (cfg *apiConfig) trendingHashtagsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := defaultTrendingLimit
+	if queryLimit := r.URL.Query().Get("limit"); queryLimit != "" {
+		n, err := strconv.Atoi(queryLimit)
+		if err != nil || n < 1 || n > maxTrendingLimit {
+			http.Error(w, "limit must be between 1 and 50", 400)
+			return
+		}
+		limit = n
+	}
+
+	trending, err := cfg.db.LoadTrendingHashtags(r.Context(), database.LoadTrendingHashtagsParams{
+		HalfLifeSeconds: cfg.trendingHalfLife.Seconds(),
+		WindowSeconds:   cfg.trendingWindow.Seconds(),
+		MaxTags:         int32(limit),
+	})
+	if err != nil {
+		log.Printf("Error loading trending hashtags: %s", err)
+		http.Error(w, "Can't load trending hashtags", 500)
+		return
+	}
+
+	response := []responseTrendingHashtag{}
+	for _, hashtag := range trending {
+		response = append(response, responseTrendingHashtag{
+			Tag:   hashtag.Tag,
+			Uses:  hashtag.Uses,
+			Score: hashtag.Score,
+		})
+	}
+
+	encodeJSON(w, response, 200)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{name: "No tags", body: "nothing to see here"},
+		{name: "Single tag", body: "#go is fun", want: []string{"go"}},
+		{name: "Lowercased", body: "Loving #GoLang", want: []string{"golang"}},
+		{name: "Duplicates ignore case", body: "#go and #Go and #GO", want: []string{"go"}},
+		{name: "Punctuation ends a tag", body: "#one, #two. #three! #four-five", want: []string{"one", "two", "three", "four"}},
+		{name: "In parentheses", body: "(#paren)", want: []string{"paren"}},
+		{name: "Underscores and digits", body: "#snake_case #2024cup", want: []string{"snake_case", "2024cup"}},
+		{name: "Needs a letter", body: "#1 #2024 #_", want: nil},
+		{name: "Unicode letters", body: "#café #日本 #Ärger", want: []string{"café", "日本", "ärger"}},
+		{name: "Not inside a word", body: "foo#bar", want: nil},
+		{name: "Not after a multibyte letter", body: "é#tag", want: nil},
+		{name: "Double hash", body: "##double", want: []string{"double"}},
+		{name: "Longest tag", body: "#" + strings.Repeat("a", maxHashtagLength), want: []string{strings.Repeat("a", maxHashtagLength)}},
+		{name: "Too long", body: "#" + strings.Repeat("a", maxHashtagLength+1), want: nil},
+		{name: "Length counts characters, not bytes", body: "#" + strings.Repeat("ß", maxHashtagLength), want: []string{strings.Repeat("ß", maxHashtagLength)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extractHashtags(tt.body)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractHashtags(%q) = %q, want %q", tt.body, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,18 +1,217 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// NoPassword is stored instead of a hash for users without a password (the column default since migration 003)
+const NoPassword = "unset"
+
+var (
+	// ErrPasswordNotSet is returned when checking a password of a user who has none
+	ErrPasswordNotSet = errors.New("no password set")
+	// ErrUnknownHash is returned for hashes in a format the hasher can't read
+	ErrUnknownHash = errors.New("unknown password hash format")
+)
+
+// PasswordParams are the argon2id parameters, Memory is in KiB
+type PasswordParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultPasswordParams follow the OWASP recommendation for argon2id (19 MiB, 2 iterations, 1 thread)
+var DefaultPasswordParams = PasswordParams{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// PasswordHasher hashes passwords with argon2id into PHC strings
+// ($argon2id$v=19$m=19456,t=2,p=1$salt$hash) and checks both those and bcrypt hashes,
+// so users from before argon2id keep logging in until their hash is upgraded.
+type PasswordHasher struct {
+	params PasswordParams
+
+	dummyOnce sync.Once
+	dummy     string // the slower to check of an argon2id and a bcrypt hash
+}
+
+// NewPasswordHasher makes a hasher for new hashes with params
+func NewPasswordHasher(params PasswordParams) (*PasswordHasher, error) {
+	if params.Iterations < 1 || params.Parallelism < 1 {
+		return nil, errors.New("argon2id needs at least one iteration and one thread")
+	}
+	if params.Memory < 8*uint32(params.Parallelism) {
+		return nil, errors.New("argon2id needs at least 8 KiB of memory per thread")
+	}
+	if params.SaltLength < 8 || params.KeyLength < 16 {
+		return nil, errors.New("argon2id salt needs at least 8 bytes and key at least 16")
+	}
+
+	return &PasswordHasher{params: params}, nil
+}
+
+var defaultHasher = &PasswordHasher{params: DefaultPasswordParams}
+
+// HashPassword hashes with the default parameters
 func HashPassword(password string) (string, error) {
-	// takes pw and cost as input
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return defaultHasher.Hash(password)
+}
+
+// CheckPasswordHash checks a password against an argon2id or bcrypt hash
+func CheckPasswordHash(password, hash string) error {
+	return defaultHasher.Check(password, hash)
+}
+
+// Hash returns an argon2id PHC string for password with a random salt
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	_, err := rand.Read(salt)
 	if err != nil {
 		return "", err
 	}
-	return string(hash), nil
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
 }
 
-func CheckPasswordHash(password, hash string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+// Check returns nil when password matches hash
+func (h *PasswordHasher) Check(password, hash string) error {
+	// as slow as a real check, so the response time doesn't tell which accounts have no password
+	if hash == NoPassword || hash == "" {
+		h.CheckDummy(password)
+		return ErrPasswordNotSet
+	}
+
+	if isBcrypt(hash) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	}
+
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return errors.New("password does not match hash")
+	}
+
+	return nil
+}
+
+// CheckDummy takes as long as checking a password against the slowest real hash,
+// for when there is no user to check against and the response time shouldn't tell
+func (h *PasswordHasher) CheckDummy(password string) {
+	h.dummyOnce.Do(func() {
+		h.dummy = h.slowestDummy()
+	})
+	// Check calls back here for an empty hash
+	if h.dummy != "" {
+		h.Check(password, h.dummy)
+	}
+}
+
+// legacy bcrypt hashes (DefaultCost) can take longer to check than argon2id ones,
+// so the dummy is whichever of the two is slower here
+func (h *PasswordHasher) slowestDummy() string {
+	argon2Hash, _ := h.Hash("not-a-real-password")
+	bcryptHash, _ := bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
+	slowest := ""
+	var slowestTime time.Duration
+	for _, hash := range []string{argon2Hash, string(bcryptHash)} {
+		// an empty hash would land back in CheckDummy
+		if hash == "" {
+			continue
+		}
+		start := time.Now()
+		h.Check("wrong-password", hash)
+		if took := time.Since(start); took > slowestTime {
+			slowest, slowestTime = hash, took
+		}
+	}
+
+	return slowest
+}
+
+// NeedsRehash reports whether hash was made with another algorithm or other parameters than Hash uses now
+func (h *PasswordHasher) NeedsRehash(hash string) bool {
+	params, salt, _, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return params.Memory != h.params.Memory ||
+		params.Iterations != h.params.Iterations ||
+		params.Parallelism != h.params.Parallelism ||
+		params.KeyLength != h.params.KeyLength ||
+		uint32(len(salt)) < h.params.SaltLength
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// reads $argon2id$v=19$m=...,t=...,p=...$salt$key
+func parseArgon2id(hash string) (PasswordParams, []byte, []byte, error) {
+	params := PasswordParams{}
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return params, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters %q", parts[3])
+	}
+	if params.Iterations < 1 || params.Parallelism < 1 {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters %q", parts[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	if len(key) == 0 {
+		return params, nil, nil, ErrUnknownHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
 }
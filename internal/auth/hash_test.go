@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
 
 	"golang.org/x/crypto/bcrypt"
@@ -89,3 +91,105 @@ func TestCheckPasswordHash_(t *testing.T) {
 		})
 	}
 }
+
+func TestHashPasswordArgon2id(t *testing.T) {
+	hash, err := HashPassword("Password123")
+	if err != nil {
+		t.Fatalf("error hashing password: %v", err)
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Fatalf("hash %q is not an argon2id PHC string with the default parameters", hash)
+	}
+
+	other, _ := HashPassword("Password123")
+	if hash == other {
+		t.Fatalf("two hashes of the same password should have different salts")
+	}
+}
+
+func TestCheckPasswordHashFormats(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("Password123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("error generating bcrypt hash: %v", err)
+	}
+	argonHash, _ := HashPassword("Password123")
+
+	tests := []struct {
+		name    string
+		hash    string
+		wantErr error
+		anyErr  bool
+	}{
+		{name: "bcrypt", hash: string(bcryptHash)},
+		{name: "argon2id", hash: argonHash},
+		{name: "No password", hash: NoPassword, wantErr: ErrPasswordNotSet},
+		{name: "Empty hash", hash: "", wantErr: ErrPasswordNotSet},
+		{name: "Unknown algorithm", hash: "$scrypt$ln=15,r=8,p=1$c2FsdA$aGFzaA", wantErr: ErrUnknownHash},
+		{name: "Bad argon2id parameters", hash: "$argon2id$v=19$m=x,t=2,p=1$c2FsdA$aGFzaA", anyErr: true},
+		{name: "Wrong argon2 version", hash: "$argon2id$v=16$m=19456,t=2,p=1$c2FsdA$aGFzaA", anyErr: true},
+		{name: "Zero iterations", hash: "$argon2id$v=19$m=19456,t=0,p=1$c2FsdA$aGFzaA", anyErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckPasswordHash("Password123", tt.hash)
+			switch {
+			case tt.anyErr:
+				if err == nil {
+					t.Errorf("CheckPasswordHash() expected an error")
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("CheckPasswordHash() error = %v, want %v", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Errorf("CheckPasswordHash() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	bcryptHash, _ := bcrypt.GenerateFromPassword([]byte("Password123"), bcrypt.MinCost)
+	current, _ := HashPassword("Password123")
+
+	stronger := DefaultPasswordParams
+	stronger.Iterations++
+	hasher, err := NewPasswordHasher(stronger)
+	if err != nil {
+		t.Fatalf("error making hasher: %v", err)
+	}
+
+	if !defaultHasher.NeedsRehash(string(bcryptHash)) {
+		t.Errorf("bcrypt hashes should be upgraded")
+	}
+	if defaultHasher.NeedsRehash(current) {
+		t.Errorf("hash with the current parameters should be kept")
+	}
+	if !hasher.NeedsRehash(current) {
+		t.Errorf("hash with fewer iterations should be upgraded")
+	}
+	if !defaultHasher.NeedsRehash(NoPassword) {
+		t.Errorf("no password is not a current hash")
+	}
+
+	upgraded, _ := hasher.Hash("Password123")
+	if err := defaultHasher.Check("Password123", upgraded); err != nil {
+		t.Errorf("hashes with other parameters should still verify: %v", err)
+	}
+}
+
+func TestNewPasswordHasherRejectsWeakParams(t *testing.T) {
+	params := DefaultPasswordParams
+	params.Memory = 4
+	if _, err := NewPasswordHasher(params); err == nil {
+		t.Errorf("expected an error for too little memory")
+	}
+
+	params = DefaultPasswordParams
+	params.Iterations = 0
+	if _, err := NewPasswordHasher(params); err == nil {
+		t.Errorf("expected an error for zero iterations")
+	}
+}
@@ -0,0 +1,423 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// issuer of every token chirpy signs
+const tokenIssuer = "chirpy"
+
+// AccessTokenAudience is the aud claim of every access token, and only of access tokens.
+// Services that verify access tokens against the JWKS have to require it along with the at+jwt typ header (RFC 9068),
+// other tokens chirpy signs with the same keys (two-factor challenges, email links) have another audience.
+const (
+	AccessTokenAudience = "chirpy-api"
+	accessTokenType     = "at+jwt"
+)
+
+// the aud claim of a purpose token, never AccessTokenAudience
+func purposeAudience(purpose string) string {
+	return "chirpy-" + purpose
+}
+
+// one asymmetric signing key, kid is the name of the pem file it was loaded from
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer
+}
+
+// Keyring signs and validates access tokens with a set of keys picked by their kid header.
+// New tokens are signed with the active key, every loaded key keeps validating tokens,
+// so a key can be rotated by adding a new one and removing the old one once its tokens expired.
+// The legacy HS256 secret validates tokens without a kid, and signs when no other key is loaded.
+type Keyring struct {
+	mu     sync.RWMutex
+	dir    string
+	kid    string
+	keys   map[string]signingKey
+	active string
+	secret []byte
+}
+
+// PurposeClaims are the claims of tokens made for one job other than API access (verifying an email address, ...).
+// Access tokens never carry a purpose, so one can't be used in place of the other.
+type PurposeClaims struct {
+	jwt.RegisteredClaims
+	Purpose string `json:"purpose"`
+	// set when the purpose is about a specific address
+	Email string `json:"email,omitempty"`
+}
+
+// AccessClaims are the claims of access tokens. Tokens issued to an OAuth client carry the client and
+// a space separated list of scopes, tokens from logging in carry neither and may do everything.
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	// the user's role (moderator, admin) when it's more than a regular user, never set on scoped tokens
+	Role string `json:"role,omitempty"`
+	// only set on purpose tokens, an access token never has one
+	Purpose string `json:"purpose,omitempty"`
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewKeyring loads every *.pem private key in dir (RSA or Ed25519), dir may be empty to only use the secret.
+// activeKid picks the signing key, when empty the key with the greatest kid signs,
+// so naming files by date (2025-01.pem, 2025-06.pem) makes the newest one active.
+func NewKeyring(dir, activeKid, legacySecret string) (*Keyring, error) {
+	k := &Keyring{
+		dir:    dir,
+		kid:    activeKid,
+		secret: []byte(legacySecret),
+	}
+
+	err := k.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Reload re-reads the key directory, on error the keys loaded before stay in use
+func (k *Keyring) Reload() error {
+	keys := map[string]signingKey{}
+
+	if k.dir != "" {
+		paths, err := filepath.Glob(filepath.Join(k.dir, "*.pem"))
+		if err != nil {
+			return err
+		}
+
+		for _, path := range paths {
+			dat, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+
+			key, err := parseSigningKey(dat)
+			if err != nil {
+				return fmt.Errorf("%s: %w", filepath.Base(path), err)
+			}
+
+			key.kid = strings.TrimSuffix(filepath.Base(path), ".pem")
+			keys[key.kid] = key
+		}
+	}
+
+	active := k.kid
+	if active == "" {
+		kids := make([]string, 0, len(keys))
+		for kid := range keys {
+			kids = append(kids, kid)
+		}
+		sort.Strings(kids)
+		if len(kids) > 0 {
+			active = kids[len(kids)-1]
+		}
+	}
+
+	if active != "" {
+		if _, ok := keys[active]; !ok {
+			return fmt.Errorf("active key %q not found in %q", active, k.dir)
+		}
+	} else if len(k.secret) == 0 {
+		return errors.New("no signing keys and no secret configured")
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = keys
+	k.active = active
+
+	return nil
+}
+
+// MakeJWT signs an access token for a regular user with the active key
+func (k *Keyring) MakeJWT(userID uuid.UUID, expiresIn time.Duration) (string, error) {
+	return k.MakeRoleJWT(userID, "", expiresIn)
+}
+
+// MakeRoleJWT signs an access token for the user that carries their role, an empty role is a regular user
+func (k *Keyring) MakeRoleJWT(userID uuid.UUID, role string, expiresIn time.Duration) (string, error) {
+	return k.sign(AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			Issuer:    tokenIssuer,
+			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{AccessTokenAudience},
+		},
+		Role: role,
+	}, accessTokenType)
+}
+
+// Sign signs any claims with the active key, or the legacy secret when there is no active key
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	return k.sign(claims, "JWT")
+}
+
+// signs claims with typ as the JOSE typ header
+func (k *Keyring) sign(claims jwt.Claims, typ string) (string, error) {
+	k.mu.RLock()
+	key, ok := k.keys[k.active]
+	k.mu.RUnlock()
+
+	if !ok {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		token.Header["typ"] = typ
+		return token.SignedString(k.secret)
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["typ"] = typ
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
+}
+
+// ValidateJWT checks an access token from logging in and returns the user it was issued to,
+// tokens limited to scopes are rejected, use ValidateAccessToken to accept those
+func (k *Keyring) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	claims, err := k.ValidateAccessToken(tokenString)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if claims.ClientID != "" || claims.Scope != "" {
+		return uuid.Nil, errors.New("token is limited to scopes")
+	}
+
+	return uuid.Parse(claims.Subject)
+}
+
+// MakeScopedJWT signs an access token for the user that an OAuth client may use within scope
+func (k *Keyring) MakeScopedJWT(userID uuid.UUID, clientID, scope string, expiresIn time.Duration) (string, error) {
+	if clientID == "" || scope == "" {
+		return "", errors.New("scoped tokens need a client and a scope")
+	}
+
+	return k.sign(AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			Issuer:    tokenIssuer,
+			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{AccessTokenAudience},
+		},
+		Scope:    scope,
+		ClientID: clientID,
+	}, accessTokenType)
+}
+
+// ValidateAccessToken checks any access token, scoped or not, and returns its claims
+func (k *Keyring) ValidateAccessToken(tokenString string) (AccessClaims, error) {
+	claims := AccessClaims{}
+	token, err := k.parse(tokenString, &claims, jwt.WithAudience(AccessTokenAudience))
+	if err != nil {
+		return claims, err
+	}
+
+	if token.Header["typ"] != accessTokenType || claims.Purpose != "" {
+		return claims, errors.New("not an access token")
+	}
+	// an OAuth client acts within its scopes, never with the user's role
+	if claims.ClientID != "" && claims.Role != "" {
+		return claims, errors.New("scoped token carries a role")
+	}
+
+	_, err = uuid.Parse(claims.Subject)
+	if err != nil {
+		return claims, err
+	}
+
+	return claims, nil
+}
+
+// MakePurposeJWT signs a token for the user that is only good for purpose
+func (k *Keyring) MakePurposeJWT(purpose string, userID uuid.UUID, email string, expiresIn time.Duration) (string, error) {
+	return k.Sign(PurposeClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			Issuer:    tokenIssuer,
+			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{purposeAudience(purpose)},
+		},
+		Purpose: purpose,
+		Email:   email,
+	})
+}
+
+// ValidatePurposeJWT checks a token made by MakePurposeJWT for the same purpose
+func (k *Keyring) ValidatePurposeJWT(tokenString, purpose string) (PurposeClaims, error) {
+	claims := PurposeClaims{}
+	if purpose == "" {
+		return claims, errors.New("no purpose given")
+	}
+
+	token, err := k.parse(tokenString, &claims, jwt.WithAudience(purposeAudience(purpose)))
+	if err != nil {
+		return claims, err
+	}
+
+	if token.Header["typ"] == accessTokenType || claims.Purpose != purpose {
+		return claims, fmt.Errorf("not a %s token", purpose)
+	}
+
+	return claims, nil
+}
+
+// Parse checks the signature, expiry and issuer of a token and fills in claims.
+// The algorithm has to match the key named by kid, so a token can't pick its own algorithm
+// (say HS256 with the public RSA key as secret, or none).
+func (k *Keyring) Parse(tokenString string, claims jwt.Claims) error {
+	_, err := k.parse(tokenString, claims)
+	return err
+}
+
+// Parse with more checks, e.g. jwt.WithAudience, returning the token for its header
+func (k *Keyring) parse(tokenString string, claims jwt.Claims, options ...jwt.ParserOption) (*jwt.Token, error) {
+	options = append([]jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "EdDSA", "HS256"}),
+		jwt.WithIssuer(tokenIssuer),
+		jwt.WithExpirationRequired(),
+	}, options...)
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, k.keyFunc, options...)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	return token, nil
+}
+
+func (k *Keyring) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	if kid == "" {
+		// tokens from before key rotation
+		if token.Method != jwt.SigningMethodHS256 || len(k.secret) == 0 {
+			return nil, errors.New("token has no kid")
+		}
+		return k.secret, nil
+	}
+
+	k.mu.RLock()
+	key, ok := k.keys[kid]
+	k.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("kid %q doesn't sign with %s", kid, token.Method.Alg())
+	}
+
+	return key.private.Public(), nil
+}
+
+// JWKS lists the public keys, the legacy secret is never published
+func (k *Keyring) JWKS() JWKS {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	kids := make([]string, 0, len(k.keys))
+	for kid := range k.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	set := JWKS{Keys: []JWK{}}
+	for _, kid := range kids {
+		key := k.keys[kid]
+		jwk := JWK{Kid: kid, Use: "sig", Alg: key.method.Alg()}
+
+		switch public := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+// reads a PKCS#8 (RSA or Ed25519) or PKCS#1 (RSA) private key
+func parseSigningKey(dat []byte) (signingKey, error) {
+	block, _ := pem.Decode(dat)
+	if block == nil {
+		return signingKey{}, errors.New("no pem block found")
+	}
+
+	var private interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return signingKey{}, fmt.Errorf("unsupported pem block %q", block.Type)
+	}
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	switch private := private.(type) {
+	case *rsa.PrivateKey:
+		if private.N.BitLen() < 2048 {
+			return signingKey{}, errors.New("rsa keys need at least 2048 bits")
+		}
+		return signingKey{method: jwt.SigningMethodRS256, private: private}, nil
+	case ed25519.PrivateKey:
+		return signingKey{method: jwt.SigningMethodEdDSA, private: private}, nil
+	}
+
+	return signingKey{}, errors.New("only RSA and Ed25519 keys are supported")
+}
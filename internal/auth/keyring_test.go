@@ -0,0 +1,403 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func writeKey(t *testing.T, dir, kid string, key interface{}) {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("error marshalling key: %v", err)
+	}
+
+	dat := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	err = os.WriteFile(filepath.Join(dir, kid+".pem"), dat, 0600)
+	if err != nil {
+		t.Fatalf("error writing key: %v", err)
+	}
+}
+
+func TestKeyringSignAndValidate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating rsa key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating ed25519 key: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		key     interface{}
+		wantAlg string
+	}{
+		{name: "RS256", key: rsaKey, wantAlg: "RS256"},
+		{name: "EdDSA", key: edKey, wantAlg: "EdDSA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeKey(t, dir, "key-1", tt.key)
+
+			keys, err := NewKeyring(dir, "", "")
+			if err != nil {
+				t.Fatalf("NewKeyring() error = %v", err)
+			}
+
+			userID := uuid.New()
+			token, err := keys.MakeJWT(userID, time.Hour)
+			if err != nil {
+				t.Fatalf("MakeJWT() error = %v", err)
+			}
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+			if err != nil {
+				t.Fatalf("error parsing token: %v", err)
+			}
+			if parsed.Method.Alg() != tt.wantAlg || parsed.Header["kid"] != "key-1" {
+				t.Errorf("token header = %v, want alg %s and kid key-1", parsed.Header, tt.wantAlg)
+			}
+
+			gotUserID, err := keys.ValidateJWT(token)
+			if err != nil {
+				t.Fatalf("ValidateJWT() error = %v", err)
+			}
+			if gotUserID != userID {
+				t.Errorf("ValidateJWT() gotUserID = %v, want %v", gotUserID, userID)
+			}
+		})
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	dir := t.TempDir()
+	_, oldKey, _ := ed25519.GenerateKey(rand.Reader)
+	writeKey(t, dir, "2025-01", oldKey)
+
+	keys, err := NewKeyring(dir, "", "")
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+
+	userID := uuid.New()
+	oldToken, _ := keys.MakeJWT(userID, time.Hour)
+
+	// a newer key becomes active on reload, tokens signed with the old key keep working
+	_, newKey, _ := ed25519.GenerateKey(rand.Reader)
+	writeKey(t, dir, "2025-06", newKey)
+	if err := keys.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	newToken, _ := keys.MakeJWT(userID, time.Hour)
+	parsed, _, _ := jwt.NewParser().ParseUnverified(newToken, &jwt.RegisteredClaims{})
+	if parsed.Header["kid"] != "2025-06" {
+		t.Errorf("new token kid = %v, want 2025-06", parsed.Header["kid"])
+	}
+
+	if _, err := keys.ValidateJWT(oldToken); err != nil {
+		t.Errorf("old token should still validate after rotation: %v", err)
+	}
+
+	// once the old key is removed its tokens stop working
+	os.Remove(filepath.Join(dir, "2025-01.pem"))
+	if err := keys.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	if _, err := keys.ValidateJWT(oldToken); err == nil {
+		t.Errorf("old token should not validate after its key was removed")
+	}
+	if _, err := keys.ValidateJWT(newToken); err != nil {
+		t.Errorf("new token should validate: %v", err)
+	}
+
+	if got := len(keys.JWKS().Keys); got != 1 {
+		t.Errorf("JWKS() has %d keys, want 1", got)
+	}
+}
+
+func TestKeyringRejects(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	writeKey(t, dir, "rsa", rsaKey)
+
+	keys, err := NewKeyring(dir, "", "legacy-secret")
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+
+	userID := uuid.New()
+	claims := jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		Issuer:    "chirpy",
+		Subject:   userID.String(),
+	}
+
+	// HS256 keyed with the public RSA key, the classic algorithm confusion
+	publicDER, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	confused.Header["kid"] = "rsa"
+	confusedToken, _ := confused.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+
+	noneToken, _ := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	unknownKid := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	unknownKid.Header["kid"] = "missing"
+	unknownKidToken, _ := unknownKid.SignedString(rsaKey)
+
+	wrongIssuer := claims
+	wrongIssuer.Issuer = "someone-else"
+	wrongIssuerToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, wrongIssuer).SignedString([]byte("legacy-secret"))
+
+	expired := claims
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	expiredToken, _ := keys.Sign(expired)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "Algorithm confusion", token: confusedToken},
+		{name: "None algorithm", token: noneToken},
+		{name: "Unknown kid", token: unknownKidToken},
+		{name: "Wrong issuer", token: wrongIssuerToken},
+		{name: "Expired", token: expiredToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := keys.ValidateJWT(tt.token); err == nil {
+				t.Errorf("ValidateJWT() should reject the token")
+			}
+		})
+	}
+
+	// tokens from before rotation, signed with the secret and without kid, still validate
+	legacyToken, _ := MakeJWT(userID, "legacy-secret", time.Hour)
+	gotUserID, err := keys.ValidateJWT(legacyToken)
+	if err != nil || gotUserID != userID {
+		t.Errorf("legacy token: ValidateJWT() = %v, %v, want %v", gotUserID, err, userID)
+	}
+}
+
+func TestKeyringLegacySecretOnly(t *testing.T) {
+	keys, err := NewKeyring("", "", "secret")
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+
+	userID := uuid.New()
+	token, _ := keys.MakeJWT(userID, time.Hour)
+
+	// without keys the keyring signs just like MakeJWT did
+	gotUserID, err := ValidateJWT(token, "secret")
+	if err != nil || gotUserID != userID {
+		t.Errorf("ValidateJWT() = %v, %v, want %v", gotUserID, err, userID)
+	}
+
+	if got := len(keys.JWKS().Keys); got != 0 {
+		t.Errorf("JWKS() has %d keys, the secret must not be published", got)
+	}
+
+	if _, err := NewKeyring("", "", ""); err == nil {
+		t.Errorf("NewKeyring() without keys or secret should fail")
+	}
+	if _, err := NewKeyring(t.TempDir(), "missing", "secret"); err == nil {
+		t.Errorf("NewKeyring() with an unknown active kid should fail")
+	}
+}
+
+func TestKeyringPurpose(t *testing.T) {
+	keys, err := NewKeyring("", "", "secret")
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+
+	userID := uuid.New()
+	token, err := keys.MakePurposeJWT("verify_email", userID, "user@example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("MakePurposeJWT() error = %v", err)
+	}
+
+	claims, err := keys.ValidatePurposeJWT(token, "verify_email")
+	if err != nil {
+		t.Fatalf("ValidatePurposeJWT() error = %v", err)
+	}
+	if claims.Subject != userID.String() || claims.Email != "user@example.com" {
+		t.Errorf("ValidatePurposeJWT() claims = %+v", claims)
+	}
+
+	// purpose tokens aren't access tokens, and access tokens have no purpose
+	if _, err := keys.ValidatePurposeJWT(token, "mfa"); err == nil {
+		t.Errorf("ValidatePurposeJWT() should reject a token made for another purpose")
+	}
+	if _, err := keys.ValidateJWT(token); err == nil {
+		t.Errorf("ValidateJWT() should reject a purpose token")
+	}
+
+	accessToken, _ := keys.MakeJWT(userID, time.Hour)
+	if _, err := keys.ValidatePurposeJWT(accessToken, "verify_email"); err == nil {
+		t.Errorf("ValidatePurposeJWT() should reject an access token")
+	}
+}
+
+func TestKeyringAudience(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating ed25519 key: %v", err)
+	}
+	dir := t.TempDir()
+	writeKey(t, dir, "key-1", edKey)
+
+	keys, err := NewKeyring(dir, "", "")
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+
+	// what another service verifying against the jwks does
+	verify := func(token string) (*jwt.Token, error) {
+		return jwt.Parse(token, func(*jwt.Token) (interface{}, error) {
+			return edKey.Public(), nil
+		}, jwt.WithIssuer("chirpy"), jwt.WithAudience(AccessTokenAudience))
+	}
+
+	userID := uuid.New()
+	accessToken, _ := keys.MakeJWT(userID, time.Hour)
+	parsed, err := verify(accessToken)
+	if err != nil {
+		t.Fatalf("verifying an access token: %v", err)
+	}
+	if parsed.Header["typ"] != "at+jwt" {
+		t.Errorf("access token typ = %v, want at+jwt", parsed.Header["typ"])
+	}
+
+	purposeToken, _ := keys.MakePurposeJWT("mfa", userID, "", time.Hour)
+	if _, err := verify(purposeToken); err == nil {
+		t.Errorf("a purpose token should fail the access token audience")
+	}
+
+	// the audience and typ alone keep it out, without looking at the purpose claim
+	bare, _ := keys.Sign(jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		Issuer:    "chirpy",
+		Subject:   userID.String(),
+		Audience:  jwt.ClaimStrings{"chirpy-mfa"},
+	})
+	if _, err := keys.ValidateJWT(bare); err == nil {
+		t.Errorf("ValidateJWT() should reject a token without the access audience")
+	}
+	untyped, _ := keys.Sign(jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		Issuer:    "chirpy",
+		Subject:   userID.String(),
+		Audience:  jwt.ClaimStrings{AccessTokenAudience},
+	})
+	if _, err := keys.ValidateJWT(untyped); err == nil {
+		t.Errorf("ValidateJWT() should reject a token without the at+jwt typ")
+	}
+}
+
+func TestKeyringScopedTokens(t *testing.T) {
+	keys, err := NewKeyring("", "", "secret")
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+
+	userID := uuid.New()
+	token, err := keys.MakeScopedJWT(userID, "client-1", "chirps:write likes:write", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeScopedJWT() error = %v", err)
+	}
+
+	claims, err := keys.ValidateAccessToken(token)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken() error = %v", err)
+	}
+	if claims.Subject != userID.String() || claims.ClientID != "client-1" || claims.Scope != "chirps:write likes:write" {
+		t.Errorf("ValidateAccessToken() claims = %+v", claims)
+	}
+
+	// a scoped token must not pass where full access is assumed
+	if _, err := keys.ValidateJWT(token); err == nil {
+		t.Errorf("ValidateJWT() should reject a scoped token")
+	}
+
+	accessToken, _ := keys.MakeJWT(userID, time.Hour)
+	claims, err = keys.ValidateAccessToken(accessToken)
+	if err != nil || claims.Scope != "" || claims.ClientID != "" {
+		t.Errorf("ValidateAccessToken() = %+v, %v for a login access token", claims, err)
+	}
+
+	purposeToken, _ := keys.MakePurposeJWT("mfa", userID, "", time.Hour)
+	if _, err := keys.ValidateAccessToken(purposeToken); err == nil {
+		t.Errorf("ValidateAccessToken() should reject a purpose token")
+	}
+
+	if _, err := keys.MakeScopedJWT(userID, "", "chirps:write", time.Hour); err == nil {
+		t.Errorf("MakeScopedJWT() should need a client")
+	}
+}
+
+func TestKeyringRoleClaim(t *testing.T) {
+	keys, err := NewKeyring("", "", "secret")
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+
+	userID := uuid.New()
+	token, err := keys.MakeRoleJWT(userID, "admin", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeRoleJWT() error = %v", err)
+	}
+
+	claims, err := keys.ValidateAccessToken(token)
+	if err != nil || claims.Role != "admin" || claims.Subject != userID.String() {
+		t.Errorf("ValidateAccessToken() = %+v, %v, want role admin", claims, err)
+	}
+
+	// the role doesn't change what ValidateJWT accepts
+	gotUserID, err := keys.ValidateJWT(token)
+	if err != nil || gotUserID != userID {
+		t.Errorf("ValidateJWT() = %v, %v, want %v", gotUserID, err, userID)
+	}
+
+	regular, _ := keys.MakeJWT(userID, time.Hour)
+	claims, err = keys.ValidateAccessToken(regular)
+	if err != nil || claims.Role != "" {
+		t.Errorf("ValidateAccessToken() = %+v, %v, want no role", claims, err)
+	}
+
+	// a client's token claiming a role is forged or broken, either way it's rejected
+	scopedWithRole, err := keys.Sign(AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			Issuer:    tokenIssuer,
+			Subject:   userID.String(),
+		},
+		Scope:    "chirps:write",
+		ClientID: "client-1",
+		Role:     "admin",
+	})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if _, err := keys.ValidateAccessToken(scopedWithRole); err == nil {
+		t.Errorf("ValidateAccessToken() should reject a scoped token with a role")
+	}
+}
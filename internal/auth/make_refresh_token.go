@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 )
 
@@ -19,3 +20,10 @@ func MakeRefreshToken() (string, error) {
 
 	return token, nil
 }
+
+// refresh tokens are stored as their sha256 digest, so a leaked database doesn't leak live tokens
+// the tokens are 32 random bytes, a plain digest is enough, no salt or slow hash needed
+func HashRefreshToken(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
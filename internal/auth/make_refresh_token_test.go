@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"testing"
+)
+
+func TestHashRefreshToken(t *testing.T) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatalf("error making refresh token: %v", err)
+	}
+
+	hash := HashRefreshToken(token)
+	if hash == token {
+		t.Fatalf("token and hash should not match")
+	}
+
+	if len(hash) != 64 {
+		t.Fatalf("expected a 64 character hex digest, got %d characters", len(hash))
+	}
+
+	if HashRefreshToken(token) != hash {
+		t.Fatalf("hashing the same token twice should give the same digest")
+	}
+
+	// same digest as encode(sha256(...), 'hex') in the migration
+	want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got := HashRefreshToken("abc"); got != want {
+		t.Fatalf("HashRefreshToken(\"abc\") = %s, want %s", got, want)
+	}
+}
+
+func TestMakePersonalAccessToken(t *testing.T) {
+	token, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatalf("error making personal access token: %v", err)
+	}
+
+	if !IsPersonalAccessToken(token) {
+		t.Fatalf("token %q should start with %q", token, PersonalAccessTokenPrefix)
+	}
+	if len(token) != len(PersonalAccessTokenPrefix)+64 {
+		t.Fatalf("expected the prefix and 64 hex characters, got %d characters", len(token))
+	}
+
+	other, _ := MakePersonalAccessToken()
+	if token == other {
+		t.Fatalf("two tokens should not match")
+	}
+
+	if IsPersonalAccessToken("eyJhbGciOiJIUzI1NiJ9.e30.sig") {
+		t.Fatalf("a jwt is not a personal access token")
+	}
+}
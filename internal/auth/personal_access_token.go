@@ -0,0 +1,22 @@
+package auth
+
+import "strings"
+
+// PersonalAccessTokenPrefix starts every personal access token, so they're easy to tell apart
+// from access tokens (JWTs) and easy to spot for secret scanners
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+// MakePersonalAccessToken returns a new random personal access token.
+// Like refresh tokens they're stored as HashRefreshToken digests, never in plain text
+func MakePersonalAccessToken() (string, error) {
+	random, err := MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	return PersonalAccessTokenPrefix + random, nil
+}
+
+// IsPersonalAccessToken reports whether a bearer token looks like a personal access token
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
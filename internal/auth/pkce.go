@@ -0,0 +1,20 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+// VerifyPKCE checks a code_verifier against the S256 code_challenge from the authorization request (RFC 7636)
+func VerifyPKCE(verifier, challenge string) bool {
+	// 43 to 128 characters, so a verifier can't be guessed
+	if len(verifier) < 43 || len(verifier) > 128 || challenge == "" {
+		return false
+	}
+
+	digest := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(digest[:])
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// challenge computed independently: base64url(sha256(verifier)) without padding
+	verifier := "dBjftJeZ4CVP-mJ92K29q3Gk1mBjfPbGn5qRxhbw7R4"
+	challenge := "SvMeWX6f60hUbeuaOAG7bWJ_BhF3sA6PiImEiG92Zs0"
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{name: "Matching verifier", verifier: verifier, challenge: challenge, want: true},
+		{name: "Wrong verifier", verifier: strings.Repeat("a", 43), challenge: challenge, want: false},
+		{name: "Plain challenge is not S256", verifier: verifier, challenge: verifier, want: false},
+		{name: "Verifier too short", verifier: "abc", challenge: challenge, want: false},
+		{name: "Verifier too long", verifier: strings.Repeat("a", 129), challenge: challenge, want: false},
+		{name: "No challenge", verifier: verifier, challenge: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyPKCE(tt.verifier, tt.challenge); got != tt.want {
+				t.Errorf("VerifyPKCE() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
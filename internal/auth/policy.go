@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// codes of PasswordError, stable so clients can show their own translated message
+const (
+	PasswordTooShort      = "password_too_short"
+	PasswordTooLong       = "password_too_long"
+	PasswordCommon        = "password_common"
+	PasswordContainsEmail = "password_contains_email"
+)
+
+// bcrypt only looks at the first 72 bytes of a password
+const maxBcryptPasswordLength = 72
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = parseCommonPasswords(commonPasswordList)
+
+// PasswordPolicy is the set of rules a new password has to pass
+type PasswordPolicy struct {
+	// in characters (runes)
+	MinLength int
+	// in bytes, at most 72 since bcrypt ignores anything after that
+	MaxLength int
+	// reject the passwords in common_passwords.txt
+	RejectCommon bool
+	// reject passwords containing the user's email address or its local part
+	RejectEmail bool
+}
+
+// DefaultPasswordPolicy follows the NIST SP 800-63B guidelines: length and a blocklist, no composition rules
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:    8,
+	MaxLength:    maxBcryptPasswordLength,
+	RejectCommon: true,
+	RejectEmail:  true,
+}
+
+// PasswordError explains why a password was rejected, Limit is the length the rule is about
+type PasswordError struct {
+	Code    string
+	Message string
+	Limit   int
+}
+
+func (e *PasswordError) Error() string {
+	return e.Message
+}
+
+// Validate checks that the policy can be satisfied at all
+func (p PasswordPolicy) Validate() error {
+	if p.MinLength < 1 {
+		return errors.New("minimum password length must be at least 1")
+	}
+	if p.MaxLength < 1 || p.MaxLength > maxBcryptPasswordLength {
+		return fmt.Errorf("maximum password length must be between 1 and %d bytes", maxBcryptPasswordLength)
+	}
+	if p.MinLength > p.MaxLength {
+		return errors.New("minimum password length is greater than the maximum")
+	}
+	return nil
+}
+
+// Check returns a *PasswordError for the first rule password breaks, emails are the user's addresses
+func (p PasswordPolicy) Check(password string, emails ...string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return &PasswordError{
+			Code:    PasswordTooShort,
+			Message: fmt.Sprintf("Password must be at least %d characters long", p.MinLength),
+			Limit:   p.MinLength,
+		}
+	}
+
+	if len(password) > p.MaxLength {
+		return &PasswordError{
+			Code:    PasswordTooLong,
+			Message: fmt.Sprintf("Password can't be longer than %d bytes", p.MaxLength),
+			Limit:   p.MaxLength,
+		}
+	}
+
+	lower := strings.ToLower(password)
+
+	if p.RejectCommon {
+		if _, ok := commonPasswords[lower]; ok {
+			return &PasswordError{
+				Code:    PasswordCommon,
+				Message: "Password is too common, pick one that is harder to guess",
+			}
+		}
+	}
+
+	if p.RejectEmail {
+		for _, email := range emails {
+			if containsEmail(lower, strings.ToLower(email)) {
+				return &PasswordError{
+					Code:    PasswordContainsEmail,
+					Message: "Password can't contain your email address",
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// the whole address, or the part before the @ when it's long enough to mean something
+func containsEmail(password, email string) bool {
+	if email == "" {
+		return false
+	}
+	if strings.Contains(password, email) {
+		return true
+	}
+
+	local, _, found := strings.Cut(email, "@")
+	return found && utf8.RuneCountInString(local) >= 3 && strings.Contains(password, local)
+}
+
+func parseCommonPasswords(list string) map[string]struct{} {
+	passwords := map[string]struct{}{}
+
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[strings.ToLower(line)] = struct{}{}
+	}
+
+	return passwords
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		emails   []string
+		wantCode string
+	}{
+		{name: "Good password", password: "correct horse battery staple", emails: []string{"test@email.com"}},
+		{name: "Too short", password: "abc", wantCode: PasswordTooShort},
+		{name: "Length counts characters, not bytes", password: "ßßßßßßßß"},
+		{name: "Too long", password: strings.Repeat("a", 73), wantCode: PasswordTooLong},
+		{name: "Multibyte over 72 bytes", password: strings.Repeat("ß", 37), wantCode: PasswordTooLong},
+		{name: "Common", password: "password123", wantCode: PasswordCommon},
+		{name: "Common ignores case", password: "QWERTY123", wantCode: PasswordCommon},
+		{name: "Contains email", password: "my-test@email.com-pw", emails: []string{"test@email.com"}, wantCode: PasswordContainsEmail},
+		{name: "Contains local part", password: "Tester-is-me", emails: []string{"tester@email.com"}, wantCode: PasswordContainsEmail},
+		{name: "Checks every email", password: "Tester-is-me", emails: []string{"old@email.com", "tester@email.com"}, wantCode: PasswordContainsEmail},
+		{name: "Short local part is ignored", password: "xyz-is-long-enough", emails: []string{"xy@email.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := DefaultPasswordPolicy.Check(tt.password, tt.emails...)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("Check() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var policyErr *PasswordError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("Check() error = %v, want a *PasswordError", err)
+			}
+			if policyErr.Code != tt.wantCode {
+				t.Errorf("Check() code = %q, want %q", policyErr.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	if err := DefaultPasswordPolicy.Validate(); err != nil {
+		t.Fatalf("default policy should be valid: %v", err)
+	}
+
+	tooLong := DefaultPasswordPolicy
+	tooLong.MaxLength = 100
+	if err := tooLong.Validate(); err == nil {
+		t.Errorf("expected an error for a maximum past bcrypt's 72 bytes")
+	}
+
+	crossed := DefaultPasswordPolicy
+	crossed.MinLength = 80
+	if err := crossed.Validate(); err == nil {
+		t.Errorf("expected an error for a minimum above the maximum")
+	}
+}
+
+func TestCommonPasswordsLoaded(t *testing.T) {
+	if len(commonPasswords) < 100 {
+		t.Fatalf("expected the embedded list to be loaded, got %d passwords", len(commonPasswords))
+	}
+	if _, ok := commonPasswords["# most common passwords from public breach corpora, one per line, compared case-insensitively"]; ok {
+		t.Errorf("comment lines shouldn't be in the list")
+	}
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RFC 6238 defaults, the only settings authenticator apps reliably support
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// codes from one step before or after the current one are accepted, for clock drift
+	totpSkew = 1
+)
+
+// the base32 alphabet without padding, as otpauth URIs use it
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a new 160 bit secret, the size RFC 4226 recommends for SHA-1
+func GenerateTOTPSecret() ([]byte, error) {
+	secret := make([]byte, 20)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// EncodeTOTPSecret is the base32 form users type into their authenticator app
+func EncodeTOTPSecret(secret []byte) string {
+	return totpEncoding.EncodeToString(secret)
+}
+
+// TOTPURI is the otpauth:// URI authenticator apps read from a QR code
+func TOTPURI(issuer, account string, secret []byte) string {
+	query := url.Values{}
+	query.Set("secret", EncodeTOTPSecret(secret))
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// TOTPStep is the number of periods since the unix epoch
+func TOTPStep(now time.Time) int64 {
+	return now.Unix() / totpPeriod
+}
+
+// TOTPCode is the code for one time step (RFC 4226 HOTP with the step as counter)
+func TOTPCode(secret []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// ValidateTOTP checks a code against the steps around now and returns the step it matched.
+// Only steps after lastStep count, so a code can't be used twice.
+func ValidateTOTP(secret []byte, code string, now time.Time, lastStep int64) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := TOTPStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if hmac.Equal([]byte(TOTPCode(secret, step)), []byte(code)) {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// GenerateRecoveryCodes returns n single-use codes like "k3m9-x2p7", for when the authenticator is lost
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	alphabet := "abcdefghjkmnpqrstuvwxyz23456789"
+	codes := make([]string, n)
+
+	for i := range codes {
+		random := make([]byte, 8)
+		_, err := rand.Read(random)
+		if err != nil {
+			return nil, err
+		}
+
+		var code strings.Builder
+		for j, b := range random {
+			if j == 4 {
+				code.WriteByte('-')
+			}
+			// 256 isn't a multiple of the alphabet size, the bias is negligible for 8 characters
+			code.WriteByte(alphabet[int(b)%len(alphabet)])
+		}
+		codes[i] = code.String()
+	}
+
+	return codes, nil
+}
+
+// NormalizeRecoveryCode makes "K3M9 X2P7" and "k3m9-x2p7" the same code before it is hashed
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
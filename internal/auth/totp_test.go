@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// test vectors from RFC 6238 appendix B (SHA-1), cut to 6 digits
+func TestTOTPCode(t *testing.T) {
+	secret := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got := TOTPCode(secret, TOTPStep(time.Unix(tt.unix, 0)))
+		if got != tt.want {
+			t.Errorf("TOTPCode() at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("error generating secret: %v", err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	step := TOTPStep(now)
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantOK   bool
+		wantStep int64
+	}{
+		{name: "Current code", code: TOTPCode(secret, step), wantOK: true, wantStep: step},
+		{name: "Previous code, clock drift", code: TOTPCode(secret, step-1), wantOK: true, wantStep: step - 1},
+		{name: "Next code, clock drift", code: TOTPCode(secret, step+1), wantOK: true, wantStep: step + 1},
+		{name: "Too old", code: TOTPCode(secret, step-2), wantOK: false},
+		{name: "Replayed", code: TOTPCode(secret, step), lastStep: step, wantOK: false},
+		{name: "Spaces are ignored", code: TOTPCode(secret, step)[:3] + " " + TOTPCode(secret, step)[3:], wantOK: true, wantStep: step},
+		{name: "Wrong length", code: "12345", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := ValidateTOTP(secret, tt.code, now, tt.lastStep)
+			if ok != tt.wantOK {
+				t.Fatalf("ValidateTOTP() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && gotStep != tt.wantStep {
+				t.Errorf("ValidateTOTP() step = %d, want %d", gotStep, tt.wantStep)
+			}
+		})
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("Chirpy", "user@example.com", []byte("12345678901234567890"))
+
+	want := "otpauth://totp/Chirpy:user@example.com?algorithm=SHA1&digits=6&issuer=Chirpy&period=30&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	if uri != want {
+		t.Errorf("TOTPURI() = %s, want %s", uri, want)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() error = %v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 9 || code[4] != '-' {
+			t.Errorf("unexpected code format %q", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+
+		if NormalizeRecoveryCode(strings.ToUpper(strings.Replace(code, "-", " ", 1))) != NormalizeRecoveryCode(code) {
+			t.Errorf("NormalizeRecoveryCode() should ignore case, dashes and spaces")
+		}
+	}
+}
+
+func TestEncryptSecret(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	secret := []byte("totp secret")
+
+	sealed, err := EncryptSecret(key, secret, []byte("user-1"))
+	if err != nil {
+		t.Fatalf("EncryptSecret() error = %v", err)
+	}
+	if bytes.Contains(sealed, secret) {
+		t.Fatalf("ciphertext contains the plaintext")
+	}
+
+	opened, err := DecryptSecret(key, sealed, []byte("user-1"))
+	if err != nil || !bytes.Equal(opened, secret) {
+		t.Fatalf("DecryptSecret() = %q, %v, want %q", opened, err, secret)
+	}
+
+	if _, err := DecryptSecret(key, sealed, []byte("user-2")); err == nil {
+		t.Errorf("DecryptSecret() should fail for other associated data")
+	}
+
+	otherKey := bytes.Repeat([]byte{8}, 32)
+	if _, err := DecryptSecret(otherKey, sealed, []byte("user-1")); err == nil {
+		t.Errorf("DecryptSecret() should fail with another key")
+	}
+
+	if _, err := ParseEncryptionKey("dG9vIHNob3J0"); err == nil {
+		t.Errorf("ParseEncryptionKey() should reject short keys")
+	}
+}
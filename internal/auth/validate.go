@@ -18,7 +18,10 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
 		Issuer:    "chirpy",
 		Subject:   userID.String(),
+		Audience:  jwt.ClaimStrings{AccessTokenAudience},
 	})
+	// same shape as the Keyring's access tokens, so they keep validating there
+	token.Header["typ"] = accessTokenType
 
 	// create JWT
 	// func (t *Token) SignedString(key interface{}) (string, error)
@@ -34,9 +37,10 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 
 	// func ParseWithClaims(tokenString string, claims Claims, keyFunc Keyfunc, options ...ParserOption) (*Token, error)
+	// only HS256, otherwise a token could pick another algorithm (or none) for itself
 	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(tokenSecret), nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 	// return empty token + err in case of failed parse
 	if err != nil {
 		// 401 Unauthorized
@@ -1,7 +1,7 @@
 // Code generated by sqlc. DO NOT EDIT.
 // versions:
 //   sqlc v1.27.0
-// source: load_chirps_by_author.sql
+// source: chirp_revisions.sql
 
 package database
 
@@ -11,26 +11,27 @@ import (
 	"github.com/google/uuid"
 )
 
-const loadChirpsByAuthor = `-- name: LoadChirpsByAuthor :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE user_id = $1
+const loadChirpRevisions = `-- name: LoadChirpRevisions :many
+SELECT id, chirp_id, body, created_at, replaced_at FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY replaced_at DESC
 `
 
-func (q *Queries) LoadChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, loadChirpsByAuthor, userID)
+func (q *Queries) LoadChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]ChirpRevision, error) {
+	rows, err := q.db.QueryContext(ctx, loadChirpRevisions, chirpID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Chirp
+	var items []ChirpRevision
 	for rows.Next() {
-		var i Chirp
+		var i ChirpRevision
 		if err := rows.Scan(
 			&i.ID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
+			&i.ChirpID,
 			&i.Body,
-			&i.UserID,
+			&i.CreatedAt,
+			&i.ReplacedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -12,7 +12,7 @@ import (
 )
 
 const getUserIdFromChirp = `-- name: GetUserIdFromChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE id = $1
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, repost_of, repost_kind FROM chirps WHERE id = $1
 `
 
 func (q *Queries) GetUserIdFromChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -24,6 +24,10 @@ func (q *Queries) GetUserIdFromChirp(ctx context.Context, id uuid.UUID) (Chirp,
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.RepostOf,
+		&i.RepostKind,
 	)
 	return i, err
 }
@@ -10,7 +10,7 @@ import (
 )
 
 const findEmail = `-- name: FindEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users 
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, avatar_url, email_verified_at, pending_email, totp_secret, totp_enabled_at, totp_last_step, mfa_failed_attempts, mfa_locked_until, role FROM users 
 WHERE email = $1
 `
 
@@ -24,6 +24,18 @@ func (q *Queries) FindEmail(ctx context.Context, email string) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.MfaFailedAttempts,
+		&i.MfaLockedUntil,
+		&i.Role,
 	)
 	return i, err
 }
@@ -7,12 +7,14 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 const loadChirpByID = `-- name: LoadChirpByID :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE id = $1
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, repost_of, repost_kind FROM chirps WHERE id = $1
 `
 
 func (q *Queries) LoadChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -24,6 +26,58 @@ func (q *Queries) LoadChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.RepostOf,
+		&i.RepostKind,
+	)
+	return i, err
+}
+
+const loadChirpDetail = `-- name: LoadChirpDetail :one
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id,
+    chirps.in_reply_to, chirps.repost_of, chirps.repost_kind,
+    (SELECT COUNT(*) FROM chirp_likes WHERE chirp_likes.chirp_id = chirps.id) AS like_count,
+    EXISTS (
+        SELECT 1 FROM chirp_likes
+        WHERE chirp_likes.chirp_id = chirps.id AND chirp_likes.user_id = $1::uuid
+    ) AS liked_by_me
+FROM chirps
+WHERE chirps.id = $2
+`
+
+type LoadChirpDetailParams struct {
+	ViewerID uuid.NullUUID
+	ID       uuid.UUID
+}
+
+type LoadChirpDetailRow struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Body       string
+	UserID     uuid.UUID
+	InReplyTo  uuid.NullUUID
+	RepostOf   uuid.NullUUID
+	RepostKind sql.NullString
+	LikeCount  int64
+	LikedByMe  bool
+}
+
+func (q *Queries) LoadChirpDetail(ctx context.Context, arg LoadChirpDetailParams) (LoadChirpDetailRow, error) {
+	row := q.db.QueryRowContext(ctx, loadChirpDetail, arg.ViewerID, arg.ID)
+	var i LoadChirpDetailRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.RepostOf,
+		&i.RepostKind,
+		&i.LikeCount,
+		&i.LikedByMe,
 	)
 	return i, err
 }
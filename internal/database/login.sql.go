@@ -7,11 +7,13 @@ package database
 
 import (
 	"context"
+
+	"github.com/google/uuid"
 )
 
 const login = `-- name: Login :one
 
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users WHERE email = $1
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, avatar_url, email_verified_at, pending_email, totp_secret, totp_enabled_at, totp_last_step, mfa_failed_attempts, mfa_locked_until, role FROM users WHERE email = $1
 `
 
 func (q *Queries) Login(ctx context.Context, email string) (User, error) {
@@ -24,6 +26,37 @@ func (q *Queries) Login(ctx context.Context, email string) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.MfaFailedAttempts,
+		&i.MfaLockedUntil,
+		&i.Role,
 	)
 	return i, err
 }
+
+const rehashPassword = `-- name: RehashPassword :exec
+UPDATE users
+SET hashed_password = $1
+WHERE id = $2
+AND hashed_password = $3
+`
+
+type RehashPasswordParams struct {
+	NewHash string
+	ID      uuid.UUID
+	OldHash string
+}
+
+// swaps in an upgraded hash of the same password, unless the password changed in the meantime
+func (q *Queries) RehashPassword(ctx context.Context, arg RehashPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, rehashPassword, arg.NewHash, arg.ID, arg.OldHash)
+	return err
+}
@@ -7,37 +7,120 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, family_id, expires_at, session_started_at, user_agent, ip_address, client_id, scopes)
 VALUES (
     $1,
     NOW(),
     NOW(),
     $2,
-    NOW() + INTERVAL '60 days'    
+    $3,
+    NOW() + make_interval(secs => $4::float8),
+    NOW(),
+    $5,
+    $6,
+    $7,
+    $8
 )
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+RETURNING token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, session_started_at, user_agent, ip_address, last_used_at, client_id, scopes
 `
 
 type CreateRefreshTokenParams struct {
-	Token  string
-	UserID uuid.UUID
+	TokenHash  string
+	UserID     uuid.UUID
+	FamilyID   uuid.UUID
+	TtlSeconds float64
+	UserAgent  string
+	IpAddress  string
+	ClientID   sql.NullString
+	Scopes     string
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.Token, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createRefreshToken,
+		arg.TokenHash,
+		arg.UserID,
+		arg.FamilyID,
+		arg.TtlSeconds,
+		arg.UserAgent,
+		arg.IpAddress,
+		arg.ClientID,
+		arg.Scopes,
+	)
+	var i RefreshToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.FamilyID,
+		&i.SessionStartedAt,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.LastUsedAt,
+		&i.ClientID,
+		&i.Scopes,
+	)
+	return i, err
+}
+
+const rotateRefreshToken = `-- name: RotateRefreshToken :one
+WITH retired AS (
+    UPDATE refresh_tokens
+    SET updated_at = NOW(),
+        revoked_at = NOW()
+    WHERE token_hash = $1
+    AND revoked_at IS NULL
+    AND expires_at > NOW()
+    AND client_id IS NOT DISTINCT FROM $2
+    RETURNING user_id, family_id, session_started_at, user_agent, ip_address, client_id, scopes
+)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, family_id, expires_at, session_started_at, user_agent, ip_address, last_used_at, client_id, scopes)
+SELECT $3, NOW(), NOW(), retired.user_id, retired.family_id, NOW() + make_interval(secs => $4::float8),
+    retired.session_started_at, retired.user_agent, retired.ip_address, NOW(), retired.client_id, retired.scopes
+FROM retired
+RETURNING token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, session_started_at, user_agent, ip_address, last_used_at, client_id, scopes
+`
+
+type RotateRefreshTokenParams struct {
+	OldTokenHash string
+	ClientID     sql.NullString
+	NewTokenHash string
+	TtlSeconds   float64
+}
+
+// retires a live token and issues its successor in the same family, in one statement
+// no row means the old token is unknown, expired, already retired or issued to another client
+// (client_id NULL for login refresh tokens)
+func (q *Queries) RotateRefreshToken(ctx context.Context, arg RotateRefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, rotateRefreshToken,
+		arg.OldTokenHash,
+		arg.ClientID,
+		arg.NewTokenHash,
+		arg.TtlSeconds,
+	)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.SessionStartedAt,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.LastUsedAt,
+		&i.ClientID,
+		&i.Scopes,
 	)
 	return i, err
 }
@@ -7,18 +7,21 @@ package database
 
 import (
 	"context"
+
+	"github.com/google/uuid"
 )
 
-const revokeToken = `-- name: RevokeToken :exec
+const revokeTokenFamily = `-- name: RevokeTokenFamily :exec
 
 UPDATE refresh_tokens
 SET updated_at = NOW(),
-    revoked_at = NOW(),
-    token = 'revoked'
-WHERE token = $1
+    revoked_at = NOW()
+WHERE family_id = $1
+AND revoked_at IS NULL
 `
 
-func (q *Queries) RevokeToken(ctx context.Context, token string) error {
-	_, err := q.db.ExecContext(ctx, revokeToken, token)
+// ends a login: revokes every token that is still live in the family
+func (q *Queries) RevokeTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeTokenFamily, familyID)
 	return err
 }
@@ -0,0 +1,163 @@
+package mailer
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// what the fake server got from one SMTP conversation
+type received struct {
+	from string
+	to   []string
+	data string
+}
+
+// a minimal SMTP server accepting a single message, enough for net/smtp
+func fakeSMTPServer(t *testing.T) (string, <-chan received) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	messages := make(chan received, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		text := textproto.NewConn(conn)
+		var msg received
+
+		text.PrintfLine("220 fake.smtp ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(line)
+
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				text.PrintfLine("250 fake.smtp")
+			case strings.HasPrefix(command, "MAIL FROM:"):
+				msg.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+				text.PrintfLine("250 OK")
+			case strings.HasPrefix(command, "RCPT TO:"):
+				msg.to = append(msg.to, strings.Trim(line[len("RCPT TO:"):], "<>"))
+				text.PrintfLine("250 OK")
+			case command == "DATA":
+				text.PrintfLine("354 go ahead")
+				dat, err := text.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				msg.data = string(dat)
+				text.PrintfLine("250 queued")
+				messages <- msg
+			case command == "QUIT":
+				text.PrintfLine("221 bye")
+				return
+			default:
+				text.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+
+	return listener.Addr().String(), messages
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	addr, messages := fakeSMTPServer(t)
+
+	m := SMTPMailer{Addr: addr, From: "Chirpy <no-reply@chirpy.test>"}
+	err := m.Send(context.Background(), Message{
+		To:      "user@example.com",
+		Subject: "Reset your password",
+		Body:    "Hello,\nclick the link.\n.\nBye",
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	select {
+	case msg := <-messages:
+		if msg.from != "no-reply@chirpy.test" {
+			t.Errorf("envelope from = %q, want no-reply@chirpy.test", msg.from)
+		}
+		if len(msg.to) != 1 || msg.to[0] != "user@example.com" {
+			t.Errorf("envelope to = %v, want [user@example.com]", msg.to)
+		}
+		for _, want := range []string{"To: user@example.com\n", "Subject: Reset your password\n", "\nclick the link.\n.\nBye\n"} {
+			if !strings.Contains(msg.data, want) {
+				t.Errorf("message doesn't contain %q:\n%s", want, msg.data)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("fake server didn't receive a message")
+	}
+}
+
+func TestSMTPMailerContext(t *testing.T) {
+	// a server that accepts the connection but never greets
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	defer listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	m := SMTPMailer{Addr: listener.Addr().String(), From: "no-reply@chirpy.test"}
+	err = m.Send(ctx, Message{To: "user@example.com", Subject: "hi", Body: "hi"})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Send() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestOutboxMailerSend(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+
+	m := OutboxMailer{Dir: dir, From: "no-reply@chirpy.test"}
+	err := m.Send(context.Background(), Message{To: "user@example.com", Subject: "Grüße", Body: "hello"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("outbox has %d messages, want 1", len(files))
+	}
+
+	dat, _ := os.ReadFile(files[0])
+	for _, want := range []string{"To: user@example.com\r\n", "Subject: =?UTF-8?q?", "\r\n\r\nhello\r\n"} {
+		if !strings.Contains(string(dat), want) {
+			t.Errorf("message doesn't contain %q:\n%s", want, dat)
+		}
+	}
+}
+
+func TestMessageRejectsHeaderInjection(t *testing.T) {
+	tests := []Message{
+		{To: "user@example.com\r\nBcc: victim@example.com", Subject: "hi"},
+		{To: "user@example.com", Subject: "hi\r\nBcc: victim@example.com"},
+		{To: "not an address", Subject: "hi"},
+	}
+
+	for _, msg := range tests {
+		if _, err := msg.bytes("no-reply@chirpy.test", time.Now()); err == nil {
+			t.Errorf("bytes() should reject %+v", msg)
+		}
+	}
+}
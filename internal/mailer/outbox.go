@@ -0,0 +1,35 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OutboxMailer writes every message to a .eml file instead of sending it, for local development
+type OutboxMailer struct {
+	Dir  string
+	From string
+}
+
+// Send writes the message to Dir, named by time so the newest sorts last
+func (m OutboxMailer) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+
+	dat, err := msg.bytes(m.From, now)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(m.Dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), uuid.NewString()[:8])
+	return os.WriteFile(filepath.Join(m.Dir, name), dat, 0600)
+}
@@ -0,0 +1,120 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+// SMTPMailer delivers through an SMTP server, using STARTTLS when the server offers it
+type SMTPMailer struct {
+	// host:port of the server
+	Addr string
+	// sender address, e.g. "Chirpy <no-reply@chirpy.example>"
+	From string
+	// optional, PLAIN auth is only sent over TLS or to localhost
+	Username string
+	Password string
+}
+
+// Send delivers the message, the context bounds the whole SMTP conversation
+func (m SMTPMailer) Send(ctx context.Context, msg Message) error {
+	dat, err := msg.bytes(m.From, time.Now())
+	if err != nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(m.Addr)
+	if err != nil {
+		return err
+	}
+
+	envelopeFrom, err := addressOnly(m.From)
+	if err != nil {
+		return err
+	}
+	envelopeTo, err := addressOnly(msg.To)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", m.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// every read and write fails once the context is done, so a stalled server can't hold on to the conversation
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	err = m.converse(conn, host, envelopeFrom, envelopeTo, dat)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// the same conversation as smtp.SendMail, on a connection that's already open
+func (m SMTPMailer) converse(conn net.Conn, host, from, to string, dat []byte) error {
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	err = c.Hello("localhost")
+	if err != nil {
+		return err
+	}
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: host})
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.Username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		err = c.Auth(smtp.PlainAuth("", m.Username, m.Password, host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.Mail(from)
+	if err != nil {
+		return err
+	}
+	err = c.Rcpt(to)
+	if err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(dat)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
@@ -0,0 +1,413 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// a small OpenID provider: discovery, jwks and a token endpoint that hands out
+// an ID token for codes made by authorize
+type mockIdP struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu     sync.Mutex
+	kid    string
+	key    *rsa.PrivateKey
+	codes  map[string]mockCode
+	issuer string
+	// how often the jwks were fetched
+	jwksHits int
+}
+
+type mockCode struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+const (
+	testClientID     = "chirpy"
+	testClientSecret = "s3cret"
+	testRedirectURL  = "http://localhost:8080/api/oidc/callback"
+)
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+
+	idp := &mockIdP{t: t, codes: map[string]mockCode{}}
+	idp.rotateKey("key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.issuer,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		idp.jwksHits++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": idp.kid,
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", idp.token)
+
+	idp.server = httptest.NewServer(mux)
+	idp.issuer = idp.server.URL
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+func (idp *mockIdP) rotateKey(kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		idp.t.Fatalf("error generating rsa key: %v", err)
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.kid = kid
+	idp.key = key
+}
+
+func (idp *mockIdP) sign(claims jwt.MapClaims) string {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = idp.kid
+	signed, err := token.SignedString(idp.key)
+	if err != nil {
+		idp.t.Fatalf("error signing id token: %v", err)
+	}
+	return signed
+}
+
+func (idp *mockIdP) claims(nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            idp.issuer,
+		"sub":            "user-123",
+		"aud":            testClientID,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          "staff@example.com",
+		"email_verified": true,
+	}
+}
+
+// what the provider does when the user signs in on the authorize page
+func (idp *mockIdP) authorize(authURL string, claims jwt.MapClaims) (string, url.Values) {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		idp.t.Fatalf("invalid auth url: %v", err)
+	}
+	query := parsed.Query()
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	code := "code-" + query.Get("state")
+	idp.codes[code] = mockCode{challenge: query.Get("code_challenge"), claims: claims}
+
+	return code, query
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != testClientID || secret != testClientSecret {
+		w.WriteHeader(401)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	idp.mu.Lock()
+	code, found := idp.codes[r.PostFormValue("code")]
+	delete(idp.codes, r.PostFormValue("code"))
+	idp.mu.Unlock()
+
+	if !found || r.PostFormValue("redirect_uri") != testRedirectURL || CodeChallenge(r.PostFormValue("code_verifier")) != code.challenge {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "provider-access-token",
+		"token_type":   "Bearer",
+		"id_token":     idp.sign(code.claims),
+	})
+}
+
+func newTestProvider(t *testing.T, idp *mockIdP) *Provider {
+	t.Helper()
+
+	p, err := NewProvider(Config{
+		Issuer:       idp.issuer,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+		Scopes:       []string{"email", "profile"},
+		HTTPClient:   idp.server.Client(),
+	})
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	return p
+}
+
+func TestProviderSignIn(t *testing.T) {
+	idp := newMockIdP(t)
+	p := newTestProvider(t, idp)
+	ctx := context.Background()
+
+	verifier := "dBjftJeZ4CVP-mJ92K29q3Gk1mBjfPbGn5qRxhbw7R4"
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+
+	code, query := idp.authorize(authURL, idp.claims("nonce-1"))
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"scope":                 "openid email profile",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        "SvMeWX6f60hUbeuaOAG7bWJ_BhF3sA6PiImEiG92Zs0",
+		"code_challenge_method": "S256",
+	}
+	for key, value := range want {
+		if got := query.Get(key); got != value {
+			t.Errorf("auth url %s = %q, want %q", key, got, value)
+		}
+	}
+
+	claims, err := p.Exchange(ctx, code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	if claims.Subject != "user-123" || claims.Email != "staff@example.com" || !bool(claims.EmailVerified) {
+		t.Errorf("Exchange() claims = %+v", claims)
+	}
+
+	// codes work once
+	_, err = p.Exchange(ctx, code, verifier, "nonce-1")
+	if err == nil {
+		t.Errorf("Exchange() with a used code succeeded")
+	}
+}
+
+func TestProviderExchangeWrongVerifier(t *testing.T) {
+	idp := newMockIdP(t)
+	p := newTestProvider(t, idp)
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", "dBjftJeZ4CVP-mJ92K29q3Gk1mBjfPbGn5qRxhbw7R4")
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	code, _ := idp.authorize(authURL, idp.claims("nonce-1"))
+
+	_, err = p.Exchange(ctx, code, "another-verifier-another-verifier-another-verifier", "nonce-1")
+	if err == nil {
+		t.Errorf("Exchange() with the wrong code verifier succeeded")
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	idp := newMockIdP(t)
+	p := newTestProvider(t, idp)
+
+	tests := []struct {
+		name    string
+		modify  func(jwt.MapClaims)
+		nonce   string
+		wantErr bool
+	}{
+		{name: "valid", nonce: "nonce-1"},
+		{name: "wrong nonce", nonce: "nonce-2", wantErr: true},
+		{name: "no nonce expected", nonce: "", wantErr: true},
+		{name: "expired", nonce: "nonce-1", wantErr: true, modify: func(c jwt.MapClaims) {
+			c["exp"] = time.Now().Add(-time.Hour).Unix()
+		}},
+		{name: "other issuer", nonce: "nonce-1", wantErr: true, modify: func(c jwt.MapClaims) {
+			c["iss"] = "https://evil.example.com"
+		}},
+		{name: "other audience", nonce: "nonce-1", wantErr: true, modify: func(c jwt.MapClaims) {
+			c["aud"] = "someone-else"
+		}},
+		{name: "several audiences without azp", nonce: "nonce-1", wantErr: true, modify: func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "someone-else"}
+		}},
+		{name: "several audiences issued to us", nonce: "nonce-1", modify: func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "someone-else"}
+			c["azp"] = testClientID
+		}},
+		{name: "email_verified as string", nonce: "nonce-1", modify: func(c jwt.MapClaims) {
+			c["email_verified"] = "true"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := idp.claims("nonce-1")
+			if tt.modify != nil {
+				tt.modify(claims)
+			}
+
+			got, err := p.VerifyIDToken(context.Background(), idp.sign(claims), tt.nonce)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyIDToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !bool(got.EmailVerified) {
+				t.Errorf("VerifyIDToken() email_verified = false, want true")
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenRejectsForgedSignature(t *testing.T) {
+	idp := newMockIdP(t)
+	p := newTestProvider(t, idp)
+
+	// same kid, different key
+	forger, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating rsa key: %v", err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.claims("nonce-1"))
+	token.Header["kid"] = "key-1"
+	forged, err := token.SignedString(forger)
+	if err != nil {
+		t.Fatalf("error signing token: %v", err)
+	}
+
+	_, err = p.VerifyIDToken(context.Background(), forged, "nonce-1")
+	if err == nil {
+		t.Errorf("VerifyIDToken() accepted a token signed with another key")
+	}
+
+	// the none algorithm is never accepted
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, idp.claims("nonce-1")).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("error making unsigned token: %v", err)
+	}
+	_, err = p.VerifyIDToken(context.Background(), unsigned, "nonce-1")
+	if err == nil {
+		t.Errorf("VerifyIDToken() accepted an unsigned token")
+	}
+}
+
+func TestProviderKeyRotation(t *testing.T) {
+	idp := newMockIdP(t)
+	p := newTestProvider(t, idp)
+	ctx := context.Background()
+
+	_, err := p.VerifyIDToken(ctx, idp.sign(idp.claims("nonce-1")), "nonce-1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken() error = %v", err)
+	}
+
+	// a new kid right after the last fetch has to wait for the refresh interval
+	idp.rotateKey("key-2")
+	_, err = p.VerifyIDToken(ctx, idp.sign(idp.claims("nonce-1")), "nonce-1")
+	if err == nil {
+		t.Fatalf("VerifyIDToken() with a new kid succeeded before the jwks could be refetched")
+	}
+
+	p.mu.Lock()
+	p.keysFetched = time.Now().Add(-2 * jwksRefreshInterval)
+	p.mu.Unlock()
+
+	_, err = p.VerifyIDToken(ctx, idp.sign(idp.claims("nonce-1")), "nonce-1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken() after key rotation error = %v", err)
+	}
+
+	idp.mu.Lock()
+	hits := idp.jwksHits
+	idp.mu.Unlock()
+	if hits != 2 {
+		t.Errorf("jwks fetched %d times, want 2", hits)
+	}
+}
+
+func TestProviderDiscoveryIssuerMismatch(t *testing.T) {
+	idp := newMockIdP(t)
+	idp.issuer = "https://idp.example.com"
+
+	p, err := NewProvider(Config{
+		Issuer:      idp.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+		HTTPClient:  idp.server.Client(),
+	})
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+
+	_, err = p.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	if err == nil {
+		t.Errorf("AuthCodeURL() succeeded with a discovery document for another issuer")
+	}
+}
+
+func TestNewProviderNeedsConfig(t *testing.T) {
+	_, err := NewProvider(Config{Issuer: "https://idp.example.com"})
+	if err == nil {
+		t.Errorf("NewProvider() without client id and redirect url succeeded")
+	}
+}
+
+func TestBoolish(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{`true`, true},
+		{`false`, false},
+		{`"true"`, true},
+		{`"false"`, false},
+	}
+
+	for _, tt := range tests {
+		var got boolish
+		err := json.Unmarshal([]byte(tt.input), &got)
+		if err != nil {
+			t.Fatalf("Unmarshal(%s) error = %v", tt.input, err)
+		}
+		if bool(got) != tt.want {
+			t.Errorf("Unmarshal(%s) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+
+	var got boolish
+	if err := json.Unmarshal([]byte(`1`), &got); err == nil {
+		t.Errorf("Unmarshal(1) succeeded")
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/peethree/chirpy/internal/auth"
+)
+
+// reloads the jwt keys every time the process gets SIGHUP
+func reloadKeysOnSignal(keys *auth.Keyring) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	for range hangup {
+		err := keys.Reload()
+		if err != nil {
+			log.Printf("Error reloading jwt keys, keeping the old ones: %s", err)
+			continue
+		}
+		log.Printf("Reloaded jwt keys")
+	}
+}
+
+// public keys other services can verify chirpy access tokens with
+func (cfg *apiConfig) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	// short cache so rotated keys show up quickly
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	encodeJSON(w, cfg.keys.JWKS(), 200)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/peethree/chirpy/internal/database"
+)
+
+// struct for responding to GET api/chirps/{chirpID}/likes
+type responseLike struct {
+	User_id    uuid.UUID `json:"user_id"`
+	Created_at time.Time `json:"created_at"`
+}
+
+// the user behind an optional bearer token, a personal access token with any scope will do
+// anonymous requests, and requests with an unusable token, get a NULL viewer instead of a 401
+func (cfg *apiConfig) optionalViewer(r *http.Request) uuid.NullUUID {
+	c, err := cfg.identify(r)
+	if err != nil {
+		return uuid.NullUUID{}
+	}
+
+	return uuid.NullUUID{UUID: c.userID, Valid: true}
+}
+
+// a chirp as the load queries return it: every column but search_vector, which only search needs, plus the like columns.
+// the load queries select the same columns in the same order, so their rows convert to it
+type loadedChirp struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Body       string
+	UserID     uuid.UUID
+	InReplyTo  uuid.NullUUID
+	RepostOf   uuid.NullUUID
+	RepostKind sql.NullString
+	LikeCount  int64
+	LikedByMe  bool
+}
+
+// chirpResponse plus the like columns computed by the load queries
+func likedChirpResponse(chirp loadedChirp, viewer uuid.NullUUID) responseChirp {
+	response := chirpResponse(database.Chirp{
+		ID:         chirp.ID,
+		CreatedAt:  chirp.CreatedAt,
+		UpdatedAt:  chirp.UpdatedAt,
+		Body:       chirp.Body,
+		UserID:     chirp.UserID,
+		InReplyTo:  chirp.InReplyTo,
+		RepostOf:   chirp.RepostOf,
+		RepostKind: chirp.RepostKind,
+	})
+	response.Like_count = chirp.LikeCount
+	if viewer.Valid {
+		response.Liked_by_me = &chirp.LikedByMe
+	}
+	return response
+}
+
+// likes a chirp, liking it again changes nothing
+func (cfg *apiConfig) likeChirpHandler(w http.ResponseWriter, r *http.Request) {
+	userID, chirpID, ok := cfg.likeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.LikeChirp(r.Context(), database.LikeChirpParams{
+		ChirpID: chirpID,
+		UserID:  userID,
+	})
+	if err != nil {
+		log.Printf("Error liking chirp: %s", err)
+		http.Error(w, "Unable to like chirp", 500)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// removes a like, unliking a chirp that wasn't liked changes nothing
+func (cfg *apiConfig) unlikeChirpHandler(w http.ResponseWriter, r *http.Request) {
+	userID, chirpID, ok := cfg.likeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.UnlikeChirp(r.Context(), database.UnlikeChirpParams{
+		ChirpID: chirpID,
+		UserID:  userID,
+	})
+	if err != nil {
+		log.Printf("Error unliking chirp: %s", err)
+		http.Error(w, "Unable to unlike chirp", 500)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// shared checks for liking and unliking: a valid jwt and an existing chirp
+// writes the error response itself and returns false when a check fails
+func (cfg *apiConfig) likeRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	c, ok := cfg.authenticate(w, r, scopeLikesWrite)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	userID := c.userID
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		http.Error(w, "Cannot find the chirp", 404)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	_, err = cfg.db.LoadChirpByID(r.Context(), chirpID)
+	if err != nil {
+		http.Error(w, "Cannot find the chirp", 404)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return userID, chirpID, true
+}
+
+// lists who liked a chirp, most recent like first
+func (cfg *apiConfig) loadChirpLikesHandler(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		http.Error(w, "Can't find this chirp", 404)
+		return
+	}
+
+	page, err := parsePageParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	_, err = cfg.db.LoadChirpByID(r.Context(), chirpID)
+	if err != nil {
+		http.Error(w, "Can't find this chirp", 404)
+		return
+	}
+
+	cursorCreatedAt, cursorID := page.cursorArgs()
+
+	likes, err := cfg.db.LoadChirpLikes(r.Context(), database.LoadChirpLikesParams{
+		ChirpID:         chirpID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		log.Printf("Error loading likes: %s", err)
+		http.Error(w, "Can't load likes", 500)
+		return
+	}
+
+	likes, next := paginate(likes, page.Limit, func(like database.ChirpLike) pageCursor {
+		return pageCursor{CreatedAt: like.CreatedAt, ID: like.UserID}
+	})
+
+	response := []responseLike{}
+	for _, like := range likes {
+		response = append(response, responseLike{
+			User_id:    like.UserID,
+			Created_at: like.CreatedAt,
+		})
+	}
+
+	setNextPageLink(w, r, next)
+	encodeJSON(w, response, 200)
+}
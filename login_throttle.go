@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/peethree/chirpy/internal/database"
+)
+
+const (
+	// failed logins allowed before locking, an ip is shared by more people than an account
+	accountFreeFailures = 5
+	ipFreeFailures      = 20
+	// the first lock, every further failure doubles it up to loginLockMax
+	loginLockBase = 30 * time.Second
+	loginLockMax  = 15 * time.Minute
+	// a day without failures starts the count over
+	loginFailureReset = 24 * time.Hour
+)
+
+// a wrong email or password
+var errIncorrectCredentials = errors.New("incorrect email or password")
+
+// logging in is locked until the time, after too many failures
+type loginLockedError struct {
+	until time.Time
+}
+
+func (e loginLockedError) Error() string {
+	return fmt.Sprintf("login locked until %s", e.until.Format(time.RFC3339))
+}
+
+// a login failure counter and how many failures it allows
+type loginThrottle struct {
+	key  string
+	free int32
+}
+
+func loginThrottles(ip, email string) []loginThrottle {
+	return []loginThrottle{
+		{key: "email:" + strings.ToLower(strings.TrimSpace(email)), free: accountFreeFailures},
+		{key: "ip:" + ip, free: ipFreeFailures},
+	}
+}
+
+// counts a login attempt against every throttle before the password is checked
+// a locked throttle rejects the attempt with a loginLockedError, the throttles that already counted it take it back
+func (cfg *apiConfig) countLoginAttempt(ctx context.Context, throttles []loginThrottle) error {
+	for i, throttle := range throttles {
+		counted, err := cfg.db.CountLoginAttempt(ctx, database.CountLoginAttemptParams{
+			Key:               throttle.key,
+			FreeFailures:      throttle.free,
+			LockSeconds:       loginLockBase.Seconds(),
+			MaxLockSeconds:    loginLockMax.Seconds(),
+			ResetAfterSeconds: loginFailureReset.Seconds(),
+		})
+		if err != nil {
+			cfg.uncountLoginAttempt(ctx, throttles[:i])
+			return err
+		}
+		if counted == 0 {
+			cfg.uncountLoginAttempt(ctx, throttles[:i])
+			return cfg.loginLocked(ctx, throttles)
+		}
+	}
+
+	return nil
+}
+
+// the error for a locked login, with the end of the longest lock on any of the throttles
+func (cfg *apiConfig) loginLocked(ctx context.Context, throttles []loginThrottle) error {
+	keys := make([]string, len(throttles))
+	for i, throttle := range throttles {
+		keys[i] = throttle.key
+	}
+
+	locks, err := cfg.db.LoadLoginLocks(ctx, keys)
+	if err != nil {
+		return err
+	}
+
+	// the lock can run out between counting and loading it, the client may retry right away then
+	until := time.Now()
+	for _, lock := range locks {
+		if lock.Valid && lock.Time.After(until) {
+			until = lock.Time
+		}
+	}
+
+	return loginLockedError{until: until}
+}
+
+// takes back an attempt that wasn't a failure after all
+func (cfg *apiConfig) uncountLoginAttempt(ctx context.Context, throttles []loginThrottle) {
+	for _, throttle := range throttles {
+		err := cfg.db.UncountLoginAttempt(ctx, throttle.key)
+		if err != nil {
+			log.Printf("Error uncounting login attempt: %s", err)
+		}
+	}
+}
+
+// a correct password clears the account's counter, the ip's only takes the attempt back,
+// so logging into your own account doesn't buy more guesses at others
+func (cfg *apiConfig) clearLoginFailures(ctx context.Context, throttles []loginThrottle) {
+	err := cfg.db.ClearLoginFailures(ctx, throttles[0].key)
+	if err != nil {
+		log.Printf("Error clearing login failures: %s", err)
+	}
+	cfg.uncountLoginAttempt(ctx, throttles[1:])
+}
+
+func tooManyLogins(w http.ResponseWriter, until time.Time) {
+	retryAfter := int(math.Ceil(time.Until(until).Seconds()))
+	w.Header().Set("Retry-After", fmt.Sprint(max(retryAfter, 1)))
+	http.Error(w, "Too many failed logins, try again later", http.StatusTooManyRequests)
+}
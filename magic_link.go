@@ -0,0 +1,282 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/peethree/chirpy/internal/auth"
+	"github.com/peethree/chirpy/internal/database"
+	"github.com/peethree/chirpy/internal/mailer"
+)
+
+const (
+	// login links are signed tokens with this purpose, they work once within magicLinkTTL
+	magicLinkPurpose = "magic_link"
+	magicLinkTTL     = 15 * time.Minute
+	// an address gets no more emails while it has this many links it could still use
+	maxLiveMagicLinks = 3
+	// holds the nonce in the browser that asked for the link
+	magicNonceCookie = "chirpy_magic_nonce"
+	magicLinkPath    = "/api/login/magic"
+)
+
+// struct for asking for a login link on POST api/login/magic
+type requestMagicLink struct {
+	Email string `json:"email"`
+}
+
+// struct for responding to POST api/login/magic, the nonce is needed again to redeem the link
+type responseMagicLink struct {
+	Nonce string `json:"nonce"`
+}
+
+// struct for redeeming a login link on POST api/login/magic/redeem
+// the nonce can also come from the cookie set when the link was requested
+type redeemMagicLink struct {
+	Token string `json:"token"`
+	Nonce string `json:"nonce"`
+}
+
+// the page the login link opens: it redeems the token from the link together with the nonce cookie on
+// POST api/login/magic/redeem, asks for the second factor if needed, and hands the tokens to the app under /app/
+var magicLoginTemplate = template.Must(template.New("magic-login").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Logging in - Chirpy</title>
+<style>
+body { font-family: sans-serif; max-width: 28rem; margin: 3rem auto; padding: 0 1rem; }
+label, input, button { display: block; width: 100%; box-sizing: border-box; }
+input { margin: 0.25rem 0 1rem; padding: 0.5rem; }
+button { padding: 0.6rem; }
+</style>
+</head>
+<body>
+<h1>Logging in to Chirpy</h1>
+<p id="message" role="status">One moment...</p>
+<form id="mfa" hidden>
+<label for="code">Two-factor code</label>
+<input id="code" name="code" autocomplete="one-time-code" required>
+<button type="submit">Log in</button>
+</form>
+<script nonce="{{.Nonce}}">
+const token = new URLSearchParams(location.search).get("token");
+// keep the token out of the history and of anything the page links to
+history.replaceState(null, "", location.pathname);
+
+const message = document.getElementById("message");
+const mfa = document.getElementById("mfa");
+let mfaToken = "";
+
+async function post(path, body) {
+  // same-origin sends the nonce cookie of the browser that asked for the link
+  return fetch(path, {
+    method: "POST",
+    credentials: "same-origin",
+    headers: {"Content-Type": "application/json"},
+    body: JSON.stringify(body),
+  });
+}
+
+async function finish(response) {
+  if (!response.ok) {
+    message.textContent = await response.text();
+    return;
+  }
+  const body = await response.json();
+  if (body.mfa_required) {
+    mfaToken = body.mfa_token;
+    mfa.hidden = false;
+    message.textContent = "Enter the code from your authenticator app, or a recovery code.";
+    return;
+  }
+  localStorage.setItem("chirpy_token", body.token);
+  localStorage.setItem("chirpy_refresh_token", body.refresh_token);
+  location.replace("/app/");
+}
+
+mfa.addEventListener("submit", async (event) => {
+  event.preventDefault();
+  finish(await post("/api/login/mfa", {mfa_token: mfaToken, code: mfa.code.value}));
+});
+
+if (token) {
+  post("/api/login/magic/redeem", {token: token}).then(finish);
+} else {
+  message.textContent = "This link is incomplete, open the one from the email again.";
+}
+</script>
+</body>
+</html>
+`))
+
+// serves the page the login link opens
+func magicLoginPageHandler(w http.ResponseWriter, r *http.Request) {
+	renderScriptPage(w, magicLoginTemplate, nil)
+}
+
+// emails a login link if the address belongs to a user
+// always answers 202 with a nonce, so the endpoint can't be used to find out who has an account
+func (cfg *apiConfig) magicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	params := requestMagicLink{}
+	err := decoder.Decode(&params)
+	if err != nil || params.Email == "" {
+		http.Error(w, "Invalid Json", 400)
+		return
+	}
+
+	// the link only works for whoever holds the nonce, so a leaked or forwarded email alone can't log in
+	nonce, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error making magic link nonce: %s", err)
+		http.Error(w, "Unable to send login link", 500)
+		return
+	}
+
+	err = cfg.sendMagicLink(r, params.Email, nonce)
+	if err != nil {
+		log.Printf("Error sending magic link: %s", err)
+		http.Error(w, "Unable to send login link", 500)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     magicNonceCookie,
+		Value:    nonce,
+		Path:     magicLinkPath,
+		MaxAge:   int(magicLinkTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(cfg.publicURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	encodeJSON(w, responseMagicLink{Nonce: nonce}, http.StatusAccepted)
+}
+
+// stores a link bound to nonce and mails it, unknown addresses and addresses with enough live links get nothing
+func (cfg *apiConfig) sendMagicLink(r *http.Request, email, nonce string) error {
+	user, err := cfg.db.FindEmail(r.Context(), email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	live, err := cfg.db.CountLiveMagicLinks(r.Context(), user.ID)
+	if err != nil {
+		return err
+	}
+	if live >= maxLiveMagicLinks {
+		return nil
+	}
+
+	// signed and naming the address, so the link dies with an email change even before it expires
+	token, err := cfg.keys.MakePurposeJWT(magicLinkPurpose, user.ID, user.Email, magicLinkTTL)
+	if err != nil {
+		return err
+	}
+
+	err = cfg.db.CreateMagicLink(r.Context(), database.CreateMagicLinkParams{
+		TokenHash:  auth.HashRefreshToken(token),
+		UserID:     user.ID,
+		NonceHash:  auth.HashRefreshToken(nonce),
+		TtlSeconds: magicLinkTTL.Seconds(),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/magic-login?token=%s", cfg.publicURL, url.QueryEscape(token))
+	cfg.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy login link",
+		Body: fmt.Sprintf("Open this link in the browser you asked for it from to log in to Chirpy.\n"+
+			"It works once and expires in %s:\n%s\n\n"+
+			"If you didn't ask to log in, ignore this email, nobody can use the link without that browser.\n", magicLinkTTL, link),
+	})
+
+	return nil
+}
+
+// logs in with the token from a login link and the nonce of the browser that asked for it, like POST api/login
+func (cfg *apiConfig) redeemMagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	params := redeemMagicLink{}
+	err := decoder.Decode(&params)
+	if err != nil || params.Token == "" {
+		http.Error(w, "Invalid Json", 400)
+		return
+	}
+
+	if params.Nonce == "" {
+		cookie, err := r.Cookie(magicNonceCookie)
+		if err == nil {
+			params.Nonce = cookie.Value
+		}
+	}
+	if params.Nonce == "" {
+		http.Error(w, "Login link has to be opened in the browser it was requested from", 400)
+		return
+	}
+
+	claims, err := cfg.keys.ValidatePurposeJWT(params.Token, magicLinkPurpose)
+	if err != nil {
+		http.Error(w, "Login link is invalid or expired", 400)
+		return
+	}
+
+	// a wrong nonce doesn't use the link up, so whoever merely saw it can't void it for the user
+	userID, err := cfg.db.UseMagicLink(r.Context(), database.UseMagicLinkParams{
+		TokenHash: auth.HashRefreshToken(params.Token),
+		NonceHash: auth.HashRefreshToken(params.Nonce),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Login link is invalid, expired or was requested from another browser", 400)
+		return
+	}
+	if err != nil {
+		log.Printf("Error using magic link: %s", err)
+		http.Error(w, "Unable to log in", 500)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: magicNonceCookie, Path: magicLinkPath, MaxAge: -1})
+
+	user, err := cfg.db.FindUserById(r.Context(), userID)
+	if err != nil || userID.String() != claims.Subject || user.Email != claims.Email {
+		http.Error(w, "Login link is invalid or expired", 400)
+		return
+	}
+
+	// getting the email proves the address is the user's
+	if !user.EmailVerifiedAt.Valid {
+		_, err = cfg.db.VerifyEmail(r.Context(), database.VerifyEmailParams{
+			ID:    user.ID,
+			Email: user.Email,
+		})
+		if err != nil {
+			log.Printf("Error verifying email: %s", err)
+		} else {
+			user.EmailVerifiedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+		}
+	}
+
+	// the link stands in for the password, two-factor authentication still applies
+	if user.TotpEnabledAt.Valid {
+		cfg.mfaChallenge(w, user)
+		return
+	}
+
+	cfg.completeLogin(w, r, user)
+}
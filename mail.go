@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/peethree/chirpy/internal/mailer"
+)
+
+// how long sending one email may take before we give up on it
+const mailTimeout = 30 * time.Second
+
+// MAILER=smtp sends through SMTP_ADDR, anything else writes emails to MAIL_OUTBOX_DIR for local development
+func mailerFromEnv() mailer.Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Chirpy <no-reply@localhost>"
+	}
+
+	if os.Getenv("MAILER") == "smtp" {
+		return mailer.SMTPMailer{
+			Addr:     os.Getenv("SMTP_ADDR"),
+			From:     from,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	}
+
+	// not in the working directory, /app/ serves that to everyone
+	dir := os.Getenv("MAIL_OUTBOX_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "chirpy-outbox")
+	}
+	return mailer.OutboxMailer{Dir: dir, From: from}
+}
+
+// sends in the background, so the response doesn't wait for (or reveal anything through) the mail server
+func (cfg *apiConfig) sendMail(msg mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+
+		err := cfg.mailer.Send(ctx, msg)
+		if err != nil {
+			log.Printf("Error sending email: %s", err)
+		}
+	}()
+}
@@ -1,13 +1,16 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
 	"os"
-	"sort"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -17,6 +20,8 @@ import (
 	_ "github.com/lib/pq"
 	"github.com/peethree/chirpy/internal/auth"
 	"github.com/peethree/chirpy/internal/database"
+	"github.com/peethree/chirpy/internal/mailer"
+	"github.com/peethree/chirpy/internal/oidc"
 )
 
 // config struct used for various resources such as updating server hits, db, checking env platform and the jwt secret token
@@ -25,10 +30,35 @@ type apiConfig struct {
 	fileserverHits atomic.Int32
 	db             *database.Queries
 	platform       string
-	JWTsecret      string
-	polkaKey       string
+	// signs and validates access tokens
+	keys     *auth.Keyring
+	polkaKey string
+	// hashtag uses older than trendingWindow don't count, newer ones lose half their weight every trendingHalfLife
+	trendingWindow   time.Duration
+	trendingHalfLife time.Duration
+	// refresh tokens expire this long after they were issued, every refresh issues a new one
+	refreshTokenTTL time.Duration
+	// when set, users can't post chirps before verifying their email address
+	requireVerifiedEmail bool
+	// hashes new passwords with argon2id and checks old bcrypt ones
+	passwords *auth.PasswordHasher
+	// rules for new passwords on signup, update and reset
+	passwordPolicy auth.PasswordPolicy
+	// encrypts TOTP secrets, two-factor authentication is off without it
+	mfaKey []byte
+	// sends password reset emails
+	mailer mailer.Mailer
+	// where the server is reachable from outside, for links in emails
+	publicURL string
+	// single sign-on with an OpenID Connect provider, off when nil
+	oidc *oidc.Provider
+	// reverse proxies whose X-Forwarded-For names the client, for the login throttle and the sessions list
+	trustedProxies []netip.Prefix
 }
 
+// chirps longer than this are rejected, both when posting and when editing
+const maxChirpLength = 140
+
 type loginParams struct {
 	Password string `json:"password"`
 	Email    string `json:"email"`
@@ -42,34 +72,84 @@ type User struct {
 	Updated_at    time.Time `json:"updated_at"`
 	Email         string    `json:"email"`
 	Is_chirpy_red bool      `json:"is_chirpy_red"`
+	Username      string    `json:"username"`
+	Display_name  string    `json:"display_name"`
+	Bio           string    `json:"bio"`
+	Avatar_url    string    `json:"avatar_url"`
+	// false until the link in the verification email was opened
+	Email_verified bool `json:"email_verified"`
+	// new address waiting for verification, only shown to the user themselves
+	Pending_email *string `json:"pending_email,omitempty"`
+	// user, moderator or admin
+	Role string `json:"role"`
+}
+
+// user fields that are safe to hand back to the user themselves
+func userResponse(user database.User) User {
+	response := User{
+		Id:             user.ID,
+		Created_at:     user.CreatedAt,
+		Updated_at:     user.UpdatedAt,
+		Email:          user.Email,
+		Is_chirpy_red:  user.IsChirpyRed,
+		Username:       user.Username,
+		Display_name:   user.DisplayName,
+		Bio:            user.Bio,
+		Avatar_url:     user.AvatarUrl,
+		Email_verified: user.EmailVerifiedAt.Valid,
+		Role:           user.Role,
+	}
+	if user.PendingEmail.Valid {
+		response.Pending_email = &user.PendingEmail.String
+	}
+	return response
 }
 
 // struct for making new users and getting their email address
 type requestUserParams struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// optional, the @handle other users mention this user by
+	Username string `json:"username"`
 }
 
 // chirp request parameters
 type Chirp struct {
-	Body   string    `json:"body"`
-	UserID uuid.UUID `json:"user_id"`
+	Body      string     `json:"body"`
+	UserID    uuid.UUID  `json:"user_id"`
+	InReplyTo *uuid.UUID `json:"in_reply_to"`
+	// quotes another chirp, the body is the quoting user's comment
+	QuoteOf *uuid.UUID `json:"quote_of"`
 }
 
 // struct for responding to api/chirps
 type responseChirp struct {
-	Error      string    `json:"error"`
-	Valid      bool      `json:"valid"`
-	ID         uuid.UUID `json:"id"`
-	Body       string    `json:"body"`
-	Created_at time.Time `json:"created_at"`
-	Updated_at time.Time `json:"updated_at"`
-	User_id    uuid.UUID `json:"user_id"`
+	Error       string     `json:"error"`
+	Valid       bool       `json:"valid"`
+	ID          uuid.UUID  `json:"id"`
+	Body        string     `json:"body"`
+	Created_at  time.Time  `json:"created_at"`
+	Updated_at  time.Time  `json:"updated_at"`
+	User_id     uuid.UUID  `json:"user_id"`
+	Edited      bool       `json:"edited"`
+	In_reply_to *uuid.UUID `json:"in_reply_to"`
+	Like_count  int64      `json:"like_count"`
+	// only present when the request was made with a bearer token
+	Liked_by_me *bool `json:"liked_by_me,omitempty"`
+	// "rechirp" or "quote", empty for regular chirps
+	Repost_kind string `json:"repost_kind,omitempty"`
+	// the reposted chirp, or a tombstone once it got deleted
+	Original *responseOriginal `json:"original,omitempty"`
+	// @handles in the body that belong to a user
+	Mentions []responseMention `json:"mentions"`
+	// not part of the response, used to look up Original
+	repostOf uuid.NullUUID
 }
 
 // struct for responding to api/refresh
 type responseRefresh struct {
-	Token string `json:"token"`
+	Token         string `json:"token"`
+	Refresh_token string `json:"refresh_token"`
 }
 
 // struct for catching polka request parameters
@@ -93,10 +173,70 @@ func main() {
 	// check if .env platform is set to dev
 	platformCheck := os.Getenv("PLATFORM")
 
-	jwtSecret := os.Getenv("SECRET")
+	// access tokens are signed with the keys in JWT_KEYS_DIR, SECRET (HS256) is the fallback
+	// and keeps validating tokens issued before the keys were set up
+	keys, err := auth.NewKeyring(os.Getenv("JWT_KEYS_DIR"), os.Getenv("JWT_ACTIVE_KID"), os.Getenv("SECRET"))
+	if err != nil {
+		log.Fatalf("Error loading jwt keys: %s", err)
+	}
+
+	// rotate keys without a restart: change the key directory, then send SIGHUP
+	go reloadKeysOnSignal(keys)
 
 	polkaKey := os.Getenv("POLKA_KEY")
 
+	// optional, tuning for GET /api/hashtags/trending
+	trendingWindow := durationEnv("TRENDING_WINDOW", 24*time.Hour)
+	trendingHalfLife := durationEnv("TRENDING_HALF_LIFE", 6*time.Hour)
+
+	// optional, how long a refresh token stays valid without being used
+	refreshTokenTTL := durationEnv("REFRESH_TOKEN_TTL", 60*24*time.Hour)
+
+	// optional, argon2id cost of new password hashes, older hashes are upgraded on the next login
+	passwordParams := auth.DefaultPasswordParams
+	passwordParams.Memory = uintEnv("PASSWORD_HASH_MEMORY_KIB", passwordParams.Memory)
+	passwordParams.Iterations = uintEnv("PASSWORD_HASH_ITERATIONS", passwordParams.Iterations)
+	passwordParams.Parallelism = uint8(min(uintEnv("PASSWORD_HASH_PARALLELISM", uint32(passwordParams.Parallelism)), 255))
+	passwords, err := auth.NewPasswordHasher(passwordParams)
+	if err != nil {
+		log.Fatalf("Invalid password hash parameters: %s", err)
+	}
+
+	// optional, minimum length of new passwords in characters
+	passwordPolicy := auth.DefaultPasswordPolicy
+	passwordPolicy.MinLength = int(uintEnv("PASSWORD_MIN_LENGTH", uint32(passwordPolicy.MinLength)))
+	err = passwordPolicy.Validate()
+	if err != nil {
+		log.Fatalf("Invalid password policy: %s", err)
+	}
+
+	// optional, base64 encoded 32 byte key for TOTP secrets (openssl rand -base64 32)
+	var mfaKey []byte
+	if encoded := os.Getenv("MFA_ENCRYPTION_KEY"); encoded != "" {
+		mfaKey, err = auth.ParseEncryptionKey(encoded)
+		if err != nil {
+			log.Fatalf("Invalid MFA_ENCRYPTION_KEY: %s", err)
+		}
+	}
+
+	// optional, base url for links in emails
+	publicURL := strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/")
+	if publicURL == "" {
+		publicURL = "http://localhost:8080"
+	}
+
+	// optional, single sign-on with an OpenID Connect provider (company SSO)
+	oidcProvider, err := oidcProviderFromEnv(publicURL)
+	if err != nil {
+		log.Fatalf("Invalid OIDC settings: %s", err)
+	}
+
+	// optional, reverse proxies in front of chirpy, without them every client behind a proxy shares its address
+	trustedProxies, err := parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %s", err)
+	}
+
 	// open connection to the db
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
@@ -111,8 +251,35 @@ func main() {
 		fileserverHits: atomic.Int32{},
 		db:             dbQueries,
 		platform:       platformCheck,
-		JWTsecret:      jwtSecret,
+		keys:           keys,
 		polkaKey:       polkaKey,
+
+		trendingWindow:       trendingWindow,
+		trendingHalfLife:     trendingHalfLife,
+		refreshTokenTTL:      refreshTokenTTL,
+		requireVerifiedEmail: os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true",
+		passwords:            passwords,
+		passwordPolicy:       passwordPolicy,
+		mfaKey:               mfaKey,
+		mailer:               mailerFromEnv(),
+		publicURL:            publicURL,
+		oidc:                 oidcProvider,
+		trustedProxies:       trustedProxies,
+	}
+
+	// one-off commands instead of serving, e.g. chirpy create-admin -email admin@example.com
+	if len(os.Args) > 1 {
+		err = apiCfg.runCommand(os.Args[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// the reset endpoint deletes every user, so outside of dev only admins may use it
+	resetHandler := apiCfg.middlewareRequireRole(roleAdmin, apiCfg.resetHandler)
+	if apiCfg.platform == "dev" {
+		resetHandler = apiCfg.resetHandler
 	}
 
 	// create new serve mux
@@ -121,23 +288,84 @@ func main() {
 	// register handlers
 	// GET
 	mux.HandleFunc("GET /api/healthz", healthzHandler)
-	// optional author id query and sorting asc/desc
+	// optional author id query, sorting asc/desc and limit/cursor pagination
 	mux.HandleFunc("GET /api/chirps", apiCfg.loadChirpsHandler)
+	// full-text search, same pagination as the chirp list
+	mux.HandleFunc("GET /api/chirps/search", apiCfg.searchChirpsHandler)
 	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.loadChirpByIDHandler)
-	mux.HandleFunc("GET /admin/metrics", apiCfg.adminMetricsHandler)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/revisions", apiCfg.chirpRevisionsHandler)
+	// ancestors and replies of a chirp, optional depth query
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", apiCfg.chirpThreadHandler)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/likes", apiCfg.loadChirpLikesHandler)
+	mux.HandleFunc("GET /api/hashtags/trending", apiCfg.trendingHashtagsHandler)
+	mux.HandleFunc("GET /api/hashtags/{tag}/chirps", apiCfg.hashtagChirpsHandler)
+	// chirps mentioning the bearer-token user
+	mux.HandleFunc("GET /api/users/me/mentions", apiCfg.mentionsHandler)
+	// the link from verification emails
+	mux.HandleFunc("GET /api/users/verify-email", apiCfg.verifyEmailHandler)
+	// public profile, by id or username
+	mux.HandleFunc("GET /api/users/{idOrUsername}", apiCfg.profileHandler)
+	// chirps by the bearer-token user and the accounts they follow
+	mux.HandleFunc("GET /api/timeline", apiCfg.timelineHandler)
+	// devices the bearer-token user is logged in on
+	mux.HandleFunc("GET /api/sessions", apiCfg.sessionsHandler)
+	mux.HandleFunc("GET /api/tokens", apiCfg.tokensHandler)
+	mux.HandleFunc("GET /api/oauth/clients", apiCfg.oauthClientsHandler)
+	// OAuth 2.0 authorization code flow with PKCE: consent page for the user
+	mux.HandleFunc("GET /oauth/authorize", apiCfg.authorizeHandler)
+	// sign in with the OpenID Connect provider, the callback logs in like POST /api/login
+	mux.HandleFunc("GET /api/oidc/login", apiCfg.oidcLoginHandler)
+	mux.HandleFunc("GET /api/oidc/callback", apiCfg.oidcCallbackHandler)
+	mux.HandleFunc("GET /admin/metrics", apiCfg.middlewareRequireRole(roleAdmin, apiCfg.adminMetricsHandler))
+	// public keys for verifying access tokens
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.jwksHandler)
+	mux.HandleFunc("GET /reset-password", resetPasswordPageHandler)
+	mux.HandleFunc("GET /magic-login", magicLoginPageHandler)
 
 	// POST
 	mux.HandleFunc("POST /api/login", apiCfg.loginHandler)
+	// second step of the login when two-factor authentication is on
+	mux.HandleFunc("POST /api/login/mfa", apiCfg.loginMFAHandler)
+	// passwordless login: emails a link, the link plus the nonce from the first call log in
+	mux.HandleFunc("POST /api/login/magic", apiCfg.magicLinkHandler)
+	mux.HandleFunc("POST /api/login/magic/redeem", apiCfg.redeemMagicLinkHandler)
+	mux.HandleFunc("POST /api/mfa/totp/enroll", apiCfg.enrollTOTPHandler)
+	mux.HandleFunc("POST /api/mfa/totp/confirm", apiCfg.confirmTOTPHandler)
+	mux.HandleFunc("POST /api/mfa/recovery-codes", apiCfg.recoveryCodesHandler)
 	mux.HandleFunc("POST /api/users", apiCfg.createUserHandler)
 	mux.HandleFunc("POST /api/chirps", apiCfg.chirpHandler)
 	mux.HandleFunc("POST /api/refresh", apiCfg.refreshHandler)
 	mux.HandleFunc("POST /api/revoke", apiCfg.revokeHandler)
+	mux.HandleFunc("POST /api/logout-all", apiCfg.logoutAllHandler)
+	// personal access tokens for bots and integrations
+	mux.HandleFunc("POST /api/tokens", apiCfg.createTokenHandler)
+	// OAuth 2.0 clients and the endpoints they call (form encoded, as the spec wants)
+	mux.HandleFunc("POST /api/oauth/clients", apiCfg.createOAuthClientHandler)
+	mux.HandleFunc("POST /oauth/authorize", apiCfg.approveAuthorizeHandler)
+	mux.HandleFunc("POST /oauth/token", apiCfg.oauthTokenHandler)
+	mux.HandleFunc("POST /oauth/introspect", apiCfg.oauthIntrospectHandler)
+	mux.HandleFunc("POST /oauth/revoke", apiCfg.oauthRevokeHandler)
+	mux.HandleFunc("POST /api/users/verify-email/resend", apiCfg.resendVerificationHandler)
+	mux.HandleFunc("POST /api/password-reset", apiCfg.passwordResetHandler)
+	mux.HandleFunc("POST /api/password-reset/confirm", apiCfg.confirmPasswordResetHandler)
 	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.chirpyRedHandler)
-	mux.HandleFunc("POST /admin/reset", apiCfg.resetHandler)
+	mux.HandleFunc("POST /admin/reset", resetHandler)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/likes", apiCfg.likeChirpHandler)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/rechirps", apiCfg.rechirpHandler)
+	mux.HandleFunc("POST /api/users/{userID}/follow", apiCfg.followUserHandler)
 	// PUT
 	mux.HandleFunc("PUT /api/users", apiCfg.updateUserHandler)
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", apiCfg.editChirpHandler)
+	mux.HandleFunc("PUT /admin/users/{userID}/role", apiCfg.middlewareRequireRole(roleAdmin, apiCfg.updateRoleHandler))
 	// DELETE
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.deleteChirpHandler)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/likes", apiCfg.unlikeChirpHandler)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/rechirps", apiCfg.undoRechirpHandler)
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", apiCfg.unfollowUserHandler)
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", apiCfg.revokeSessionHandler)
+	mux.HandleFunc("DELETE /api/tokens/{tokenID}", apiCfg.revokeTokenHandler)
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", apiCfg.deleteOAuthClientHandler)
+	mux.HandleFunc("DELETE /api/mfa/totp", apiCfg.disableTOTPHandler)
 
 	// use serve mux method to register fileserver handler for rootpath "/app/"
 	// strip prefix from the request path before passing it to the fileserver handler
@@ -214,26 +442,19 @@ func (cfg *apiConfig) chirpyRedHandler(w http.ResponseWriter, r *http.Request) {
 func (cfg *apiConfig) deleteChirpHandler(w http.ResponseWriter, r *http.Request) {
 	// compare the token of the user trying to delete the tweet to that of the author of the tweet
 
-	bearerToken, err := auth.GetBearerToken(r.Header)
-	// respond with 401 if missing or malformed
-	if err != nil {
-		http.Error(w, "auth bearer token required for updating email/password", http.StatusUnauthorized)
-		return
-	}
-
-	// get the user that is trying to delete a chirp, based on his access token
-	tokenUser, err := auth.ValidateJWT(bearerToken, cfg.JWTsecret)
-	if err != nil {
-		http.Error(w, "user does not have a valid access token", http.StatusUnauthorized)
+	// get the user that is trying to delete a chirp, based on their access token
+	c, ok := cfg.authenticate(w, r, scopeChirpsDelete)
+	if !ok {
 		return
 	}
+	tokenUser := c.userID
 
 	// get the user who originally posted the chirp using the url path
 	pathValue := r.PathValue("chirpID")
 
 	chirpID, err := uuid.Parse(pathValue)
 	if err != nil {
-		fmt.Println("%s", err)
+		fmt.Println(err)
 	}
 
 	chirp, err := cfg.db.LoadChirpByID(r.Context(), chirpID)
@@ -243,8 +464,8 @@ func (cfg *apiConfig) deleteChirpHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// if the two don't match, return 403 error code
-	if chirp.UserID != tokenUser {
+	// if the two don't match, return 403 error code, unless a moderator is cleaning up
+	if chirp.UserID != tokenUser && !c.hasRole(roleModerator) {
 		http.Error(w, "Cannot delete others' chirps", http.StatusForbidden)
 		return
 	}
@@ -262,166 +483,110 @@ func (cfg *apiConfig) deleteChirpHandler(w http.ResponseWriter, r *http.Request)
 }
 
 func (cfg *apiConfig) updateUserHandler(w http.ResponseWriter, r *http.Request) {
-	// access token in header
-	bearerToken, err := auth.GetBearerToken(r.Header)
-	// respond with 401 if missing or malformed
-	if err != nil {
-		http.Error(w, "auth bearer token required for updating email/password", http.StatusUnauthorized)
-		return
-	}
-
-	// look which user it is based on bearer token, function returns user ID (uuid.UUID)
-	user, err := auth.ValidateJWT(bearerToken, cfg.JWTsecret)
-	if err != nil {
-		http.Error(w, "user does not have a valid access token", http.StatusUnauthorized)
+	// look which user it is based on the access token
+	c, ok := cfg.authenticate(w, r, scopeProfileWrite)
+	if !ok {
 		return
 	}
+	user := c.userID
 
-	// decode the request body
+	// decode the request body, every field is optional
 	decoder := json.NewDecoder(r.Body)
-	params := loginParams{}
-	err = decoder.Decode(&params)
+	params := updateUserParams{}
+	err := decoder.Decode(&params)
 	if err != nil {
-		fmt.Printf("%s", err)
+		fmt.Println(err)
 		http.Error(w, "Invalid Json", 400)
 		return
 	}
 
-	// email field can't be empty
-	if params.Email == "" {
-		http.Error(w, "No email address given", http.StatusUnauthorized)
-		return
-	}
-
-	// password field may not be empty either
-	if params.Password == "" {
-		http.Error(w, "No password given", http.StatusUnauthorized)
+	// taking over the account shouldn't be one leaked token away
+	if c.scoped && (params.Email != nil || params.Password != nil) {
+		http.Error(w, "Changing the email address or password needs a login session", http.StatusForbidden)
 		return
 	}
 
-	// look for email in db -- SELECT id, created_at, updated_at, email, hashed_password FROM users WHERE email = $1
-	// func (q *Queries) FindEmail(ctx context.Context, email string) (User, error) {
-	_, err = cfg.db.FindEmail(r.Context(), params.Email)
-	// if email is found in db -> nil error -> it's already being used
-	if err == nil {
-		http.Error(w, "Email address is in use already", http.StatusUnauthorized)
+	// email has to be a plain address
+	if params.Email != nil && !validEmail(*params.Email) {
+		http.Error(w, "Invalid email address", 400)
 		return
 	}
 
-	// hash the password
-	hashedPassword, err := auth.HashPassword(params.Password)
+	err = params.validateProfile()
 	if err != nil {
-		http.Error(w, "Unable to hash password", http.StatusUnauthorized)
+		http.Error(w, err.Error(), 400)
 		return
 	}
 
-	// update user's db row with new email and new pw hash
-	// func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) error {
-	err = cfg.db.UpdateUser(r.Context(), database.UpdateUserParams{
-		// arg.Email, arg.HashedPassword, arg.ID
-		Email:          params.Email,
-		HashedPassword: hashedPassword,
-		ID:             user,
-	})
+	currentUser, err := cfg.db.FindUserById(r.Context(), user)
 	if err != nil {
-		http.Error(w, "Unable to update user's data", http.StatusUnauthorized)
-		return
-	}
-
-	// find the updated user data based on user id
-	// func (q *Queries) FindUserById(ctx context.Context, id uuid.UUID) (User, error) {
-	updatedUser, err := cfg.db.FindUserById(r.Context(), user)
-	if err != nil {
-		http.Error(w, "Error finding the user based on id", http.StatusUnauthorized)
-		return
-	}
-
-	// populate response
-	response := User{
-		Id:            updatedUser.ID,
-		Created_at:    updatedUser.CreatedAt,
-		Updated_at:    updatedUser.UpdatedAt,
-		Email:         updatedUser.Email,
-		Is_chirpy_red: updatedUser.IsChirpyRed,
-	}
-
-	// encode response
-	dat, err := json.Marshal(response)
-	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
-		w.WriteHeader(500)
+		http.Error(w, "Unable to find the user", 404)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(200)
-	w.Write(dat)
-}
 
-func (cfg *apiConfig) revokeHandler(w http.ResponseWriter, r *http.Request) {
-	// get the bearer token from authorization header
-	refreshToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		http.Error(w, "can't get the bearer token from the auth header", http.StatusUnauthorized)
-		return
+	update := database.UpdateUserParams{
+		Username:    nullString(params.Username),
+		DisplayName: nullString(params.Display_name),
+		Bio:         nullString(params.Bio),
+		AvatarUrl:   nullString(params.Avatar_url),
+		ID:          user,
 	}
 
-	// if token is empty respond with 401 code
-	if refreshToken == "" {
-		http.Error(w, "No refresh token found", http.StatusUnauthorized)
-		return
+	// a new email address only takes over once it's verified
+	if params.Email != nil && *params.Email != currentUser.Email {
+		// look for email in db, if it's found it's already being used
+		_, err := cfg.db.FindEmail(r.Context(), *params.Email)
+		if err == nil {
+			http.Error(w, "Email address is in use already", http.StatusConflict)
+			return
+		}
+		update.PendingEmail = sql.NullString{String: *params.Email, Valid: true}
 	}
 
-	// look for the token in the db, no need to store a variable for the token in this case
-	token, err := cfg.db.FindRefreshToken(r.Context(), refreshToken)
-	if err != nil {
-		http.Error(w, "No match with token in DB", http.StatusUnauthorized)
-		return
-	}
+	// hash the password, it can't contain the current or the new email address
+	if params.Password != nil {
+		emails := []string{currentUser.Email}
+		if update.PendingEmail.Valid {
+			emails = append(emails, update.PendingEmail.String)
+		}
+		if !cfg.acceptablePassword(w, *params.Password, emails...) {
+			return
+		}
 
-	// revoke the token if found -- UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW() WHERE token = $1;
-	err = cfg.db.RevokeToken(r.Context(), token.Token)
-	if err != nil {
-		fmt.Println("%s", err)
-		http.Error(w, "Unable to revoke the refresh token", http.StatusUnauthorized)
-		return
+		hashedPassword, err := cfg.passwords.Hash(*params.Password)
+		if err != nil {
+			log.Printf("Error hashing password: %s", err)
+			http.Error(w, "Unable to hash password", 500)
+			return
+		}
+		update.HashedPassword = sql.NullString{String: hashedPassword, Valid: true}
 	}
 
-	// respond with 204 code if all goes well
-	w.WriteHeader(204)
-}
-
-func (cfg *apiConfig) refreshHandler(w http.ResponseWriter, r *http.Request) {
-	refreshToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		http.Error(w, "can't get authorization header", http.StatusUnauthorized)
+	// update only the given fields, returns the user as stored
+	updatedUser, err := cfg.db.UpdateUser(r.Context(), update)
+	if err != nil && isUniqueViolation(err) {
+		http.Error(w, "Username or email address is taken", http.StatusConflict)
 		return
 	}
-
-	// if token is empty respond with 401 code
-	if refreshToken == "" {
-		http.Error(w, "No refresh token found", http.StatusUnauthorized)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Unable to find the user", 404)
 		return
 	}
-
-	// look for the token in the db with sqlc generated helper function based on query SELECT * FROM refresh_tokens WHERE token = $1;
-	token, err := cfg.db.FindRefreshToken(r.Context(), refreshToken)
 	if err != nil {
-		// token is expired or doesn't exist
-		http.Error(w, "No match with token in DB", http.StatusUnauthorized)
+		log.Printf("Error updating user: %s", err)
+		http.Error(w, "Unable to update user's data", 500)
 		return
 	}
 
-	// create a new jwt token for the user if there's a match in the db with the refresh token (expires in 1 hour)
-	jwtToken, err := auth.MakeJWT(token.UserID, cfg.JWTsecret, time.Hour)
-	if err != nil {
-		http.Error(w, "Unable to create new jwt token", http.StatusUnauthorized)
-		return
+	if update.PendingEmail.Valid {
+		err = cfg.sendVerificationEmail(updatedUser.ID, updatedUser.PendingEmail.String)
+		if err != nil {
+			log.Printf("Error sending verification email: %s", err)
+		}
 	}
 
-	// populate response with the token value
-	response := responseRefresh{
-		Token: jwtToken,
-	}
+	// populate response
+	response := userResponse(updatedUser)
 
 	// encode response
 	dat, err := json.Marshal(response)
@@ -436,12 +601,6 @@ func (cfg *apiConfig) refreshHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (cfg *apiConfig) loginHandler(w http.ResponseWriter, r *http.Request) {
-	type Response struct {
-		User
-		Token         string `json:"token"`
-		Refresh_token string `json:"refresh_token"`
-	}
-
 	// decode JSON body
 	decoder := json.NewDecoder(r.Body)
 	params := loginParams{}
@@ -451,220 +610,203 @@ func (cfg *apiConfig) loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// authenticate user:
-	// check to see if email is in the table then compare password
-	userExist, err := cfg.db.Login(r.Context(), params.Email)
+	userExist, err := cfg.checkCredentials(r, params.Email, params.Password)
+	var locked loginLockedError
+	if errors.As(err, &locked) {
+		tooManyLogins(w, locked.until)
+		return
+	}
+	if errors.Is(err, errIncorrectCredentials) {
+		http.Error(w, "Incorrect email or password", http.StatusUnauthorized)
+		return
+	}
 	if err != nil {
-		fmt.Println("%s", err)
-		// 401 unauthorized
-		http.Error(w, "This email does not match the database", http.StatusUnauthorized)
+		log.Printf("Error checking credentials: %s", err)
+		http.Error(w, "Unable to log in", 500)
 		return
 	}
 
-	// check if the hash matches password if the user's email exists
-	if auth.CheckPasswordHash(params.Password, userExist.HashedPassword) != nil {
-		fmt.Println("%s", err)
-		// 401 unauthorized
-		http.Error(w, "Wrong password", http.StatusUnauthorized)
+	// with two-factor authentication the password alone only gets a challenge for the second factor
+	if userExist.TotpEnabledAt.Valid {
+		cfg.mfaChallenge(w, userExist)
 		return
 	}
 
-	// if token is expired, return 401 response
-
-	expirationTime := time.Hour
+	// when the user exists and the password matches the hash -> log them in
+	cfg.completeLogin(w, r, userExist)
+}
 
-	// token
-	// func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	jwt, err := auth.MakeJWT(
-		userExist.ID,
-		cfg.JWTsecret,
-		expirationTime,
-	)
+// checks an email and password for every way to log in with them, counting failures against the login throttles
+// an unknown email and a wrong password get the same error in about the same time,
+// so the caller can't tell which emails have an account
+func (cfg *apiConfig) checkCredentials(r *http.Request, email, password string) (database.User, error) {
+	// the attempt counts as a failure until the password turns out to be right
+	throttles := loginThrottles(cfg.clientIP(r), email)
+	err := cfg.countLoginAttempt(r.Context(), throttles)
 	if err != nil {
-		fmt.Println("%s", err)
-		// 401 unauthorized
-		http.Error(w, "Unable to make a token", http.StatusUnauthorized)
-		return
+		return database.User{}, err
 	}
 
-	// refresh token
-	// func MakeRefreshToken() string, error {
-	refreshToken, err := auth.MakeRefreshToken()
+	// check to see if email is in the table then compare password
+	user, err := cfg.db.Login(r.Context(), email)
+	if errors.Is(err, sql.ErrNoRows) {
+		cfg.passwords.CheckDummy(password)
+		return database.User{}, errIncorrectCredentials
+	}
 	if err != nil {
-		fmt.Println("%s", err)
-		http.Error(w, "Unable to make a refresh token", http.StatusUnauthorized)
-		return
+		return database.User{}, err
 	}
 
-	// populate db with required refresh token fields
-	// func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
-	token, err := cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:  refreshToken,
-		UserID: userExist.ID,
-	})
-	if err != nil {
-		fmt.Println("%s", err)
-		return
+	// users without a password (auth.NoPassword) can't log in with one
+	if cfg.passwords.Check(password, user.HashedPassword) != nil {
+		return database.User{}, errIncorrectCredentials
 	}
 
-	// when the user exists and the password matches the hash -> encode response (login user)
-	response := Response{
-		User: User{
-			Id:            userExist.ID,
-			Created_at:    userExist.CreatedAt,
-			Updated_at:    userExist.UpdatedAt,
-			Email:         userExist.Email,
-			Is_chirpy_red: userExist.IsChirpyRed,
-		},
-		Token:         jwt,
-		Refresh_token: token.Token,
+	cfg.clearLoginFailures(r.Context(), throttles)
+
+	// bcrypt hashes and argon2id hashes with outdated parameters get replaced while the password is at hand
+	if cfg.passwords.NeedsRehash(user.HashedPassword) {
+		cfg.rehashPassword(r.Context(), user, password)
 	}
 
-	// encode response
-	dat, err := json.Marshal(response)
+	return user, nil
+}
+
+// stores a fresh hash of the password the user just logged in with
+func (cfg *apiConfig) rehashPassword(ctx context.Context, user database.User, password string) {
+	hash, err := cfg.passwords.Hash(password)
 	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
-		w.WriteHeader(500)
+		log.Printf("Error rehashing password: %s", err)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(200)
-	w.Write(dat)
+
+	err = cfg.db.RehashPassword(ctx, database.RehashPasswordParams{
+		NewHash: hash,
+		ID:      user.ID,
+		OldHash: user.HashedPassword,
+	})
+	if err != nil {
+		log.Printf("Error storing rehashed password: %s", err)
+	}
 }
 
 func (cfg *apiConfig) loadChirpByIDHandler(w http.ResponseWriter, r *http.Request) {
 	// You can get the string value of the path parameter like in Go with the http.Request.PathValue method.
 	pathValue := r.PathValue("chirpID")
-	// pathvalue returns a string, LoadChirpByID expects a uuid.UUID type input parameter
+	// pathvalue returns a string, LoadChirpDetail expects a uuid.UUID type input parameter
 	chirpID, err := uuid.Parse(pathValue)
 	if err != nil {
-		fmt.Println("%s", err)
+		fmt.Println(err)
 	}
 
-	// sqlc generated helper function based on query: SELECT * FROM chirps WHERE id = $1;
-	chirp, err := cfg.db.LoadChirpByID(r.Context(), chirpID)
+	// liked_by_me is only filled in when the request carries a bearer token
+	viewer := cfg.optionalViewer(r)
+
+	// the chirp together with its like count
+	chirp, err := cfg.db.LoadChirpDetail(r.Context(), database.LoadChirpDetailParams{
+		ViewerID: viewer,
+		ID:       chirpID,
+	})
 	if err != nil {
-		fmt.Println("%s", err)
+		fmt.Println(err)
 		// 404
 		http.Error(w, "Can't find this chirp", 404)
 		return
 	}
 
-	response := responseChirp{
-		ID:         chirp.ID,
-		Created_at: chirp.CreatedAt,
-		Updated_at: chirp.UpdatedAt,
-		Body:       chirp.Body,
-		User_id:    chirp.UserID,
+	response := likedChirpResponse(loadedChirp(chirp), viewer)
+
+	// rechirps and quotes embed the chirp they repost
+	err = cfg.hydrateChirps(r.Context(), []*responseChirp{&response}, viewer)
+	if err != nil {
+		log.Printf("Error loading original chirp: %s", err)
+		http.Error(w, "Can't load chirp", 500)
+		return
 	}
 
 	encodeResponse(w, response, 200)
 }
 
-// retrieves all chirps in ascending order by created_at (oldest first)
+// retrieves one page of chirps, in ascending order by created_at (oldest first) unless sort=desc
 func (cfg *apiConfig) loadChirpsHandler(w http.ResponseWriter, r *http.Request) {
-	// if there is query, retrieve just the chirps from that query
-	queryAuthor := r.URL.Query().Get("author_id")
-	// optional sorting query
-	querySort := r.URL.Query().Get("sort")
-
-	// when no query is given, load every chirp
-	if queryAuthor == "" {
-		loadedChirps, err := cfg.db.LoadChirps(r.Context())
-		if err != nil {
-			http.Error(w, "Can't load chirps", 400)
-		}
-
-		var response []responseChirp
-
-		// loop over all loaded chirps, fill up a responseChirp struct for each chirp, append it to the response slice
-		for _, chirp := range loadedChirps {
-			individualChirp := responseChirp{
-				Body:       chirp.Body,
-				Created_at: chirp.CreatedAt,
-				Updated_at: chirp.UpdatedAt,
-				User_id:    chirp.UserID,
-			}
-			response = append(response, individualChirp)
-		}
-		// response variable as a slice of responseChirp structs
-		// sort the chirps by created_at in ascending order by default and if query is asc
-		if querySort == "asc" && querySort == "" {
-			sort.Slice(response, func(i, j int) bool {
-				return response[i].Created_at.Before(response[j].Created_at)
-			})
-		}
+	query := r.URL.Query()
 
-		if querySort == "desc" {
-			// descending order
-			sort.Slice(response, func(i, j int) bool {
-				return response[i].Created_at.After(response[j].Created_at)
-			})
-		}
+	// limit and cursor for keyset pagination
+	page, err := parsePageParams(query)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 
-		// marshal the chirps, encoderesponse function does not work with a slice of responseChirp as a parameter
-		dat, err := json.Marshal(response)
-		if err != nil {
-			log.Printf("Error marshalling JSON: %s", err)
-			w.WriteHeader(500)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(200)
-		w.Write(dat)
-	} else {
-		// parse query to uuid type
-		author, err := uuid.Parse(queryAuthor)
+	// optional author filter, NULL loads every author
+	author := uuid.NullUUID{}
+	if queryAuthor := query.Get("author_id"); queryAuthor != "" {
+		authorID, err := uuid.Parse(queryAuthor)
 		if err != nil {
 			http.Error(w, "unable to parse query into uuid", 400)
-		}
-
-		// look for query (chirp author) in db
-		loadedChirps, err := cfg.db.LoadChirpsByAuthor(r.Context(), author)
-		if err != nil {
-			http.Error(w, "Cannot find this user's chirps", 400)
 			return
 		}
-		var response []responseChirp
-
-		for _, chirp := range loadedChirps {
-			individualChirp := responseChirp{
-				Body:       chirp.Body,
-				Created_at: chirp.CreatedAt,
-				Updated_at: chirp.UpdatedAt,
-				User_id:    chirp.UserID,
-			}
-			response = append(response, individualChirp)
+		author = uuid.NullUUID{UUID: authorID, Valid: true}
+	}
+
+	cursorCreatedAt, cursorID := page.cursorArgs()
+
+	viewer := cfg.optionalViewer(r)
+
+	// optional sorting query, ordering happens in the db
+	// both queries return the same columns, desc rows are converted to the asc row type
+	var loadedChirps []database.LoadChirpsPageAscRow
+	switch query.Get("sort") {
+	case "", "asc":
+		loadedChirps, err = cfg.db.LoadChirpsPageAsc(r.Context(), database.LoadChirpsPageAscParams{
+			ViewerID:        viewer,
+			AuthorID:        author,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			PageLimit:       page.fetchLimit(),
+		})
+	case "desc":
+		var descChirps []database.LoadChirpsPageDescRow
+		descChirps, err = cfg.db.LoadChirpsPageDesc(r.Context(), database.LoadChirpsPageDescParams{
+			ViewerID:        viewer,
+			AuthorID:        author,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			PageLimit:       page.fetchLimit(),
+		})
+		for _, chirp := range descChirps {
+			loadedChirps = append(loadedChirps, database.LoadChirpsPageAscRow(chirp))
 		}
+	default:
+		http.Error(w, "sort must be asc or desc", 400)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading chirps: %s", err)
+		http.Error(w, "Can't load chirps", 500)
+		return
+	}
 
-		// response variable as a slice of responseChirp structs
-		// sort the chirps by created_at in ascending order
-		if querySort == "asc" && querySort == "" {
-			{
-				sort.Slice(response, func(i, j int) bool {
-					return response[i].Created_at.Before(response[j].Created_at)
-				})
-			}
+	loadedChirps, next := paginate(loadedChirps, page.Limit, func(chirp database.LoadChirpsPageAscRow) pageCursor {
+		return pageCursor{CreatedAt: chirp.CreatedAt, ID: chirp.ID}
+	})
 
-			if querySort == "desc" {
-				// descending order
-				sort.Slice(response, func(i, j int) bool {
-					return response[i].Created_at.After(response[j].Created_at)
-				})
-			}
+	// always an array, even when the page is empty
+	response := []responseChirp{}
+	for _, chirp := range loadedChirps {
+		response = append(response, likedChirpResponse(loadedChirp(chirp), viewer))
+	}
 
-			// marshal the chirps, encode response function does not work with a slice of responseChirp as a parameter
-			dat, err := json.Marshal(response)
-			if err != nil {
-				log.Printf("Error marshalling JSON: %s", err)
-				w.WriteHeader(500)
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(200)
-			w.Write(dat)
-		}
+	// rechirps and quotes embed the chirp they repost
+	err = cfg.hydrateChirps(r.Context(), chirpRefs(response), viewer)
+	if err != nil {
+		log.Printf("Error loading original chirps: %s", err)
+		http.Error(w, "Can't load chirps", 500)
+		return
 	}
+
+	setNextPageLink(w, r, next)
+	encodeJSON(w, response, 200)
 }
 
 // create chirp handler
@@ -679,51 +821,88 @@ func (cfg *apiConfig) chirpHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// to create a chirp, a user needs to have a valid jwt
-	// get the header for the bearer token
-	bearerToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		fmt.Printf("%s", err)
-		http.Error(w, "Can't get bearer token", http.StatusUnauthorized)
+	// to create a chirp, a user needs to have a valid access token
+	c, ok := cfg.authenticate(w, r, scopeChirpsWrite)
+	if !ok {
 		return
 	}
+	userID := c.userID
 
-	fmt.Printf("Received token: %s\n", bearerToken)
-
-	// check jwt for validity
-	userID, err := auth.ValidateJWT(bearerToken, cfg.JWTsecret)
+	// posting may require a verified email address
+	allowed, err := cfg.mayPost(r.Context(), userID)
 	if err != nil {
-		fmt.Printf("%s", err)
-		http.Error(w, "Invalid JWT", http.StatusUnauthorized)
+		log.Printf("Error checking email verification: %s", err)
+		http.Error(w, "Unable to post", 500)
+		return
+	}
+	if !allowed {
+		http.Error(w, "Verify your email address before posting", http.StatusForbidden)
 		return
 	}
 
+	// optional parent chirp, it has to exist
+	inReplyTo := uuid.NullUUID{}
+	if params.InReplyTo != nil {
+		_, err := cfg.db.LoadChirpByID(r.Context(), *params.InReplyTo)
+		if err != nil {
+			http.Error(w, "Can't find the chirp being replied to", 404)
+			return
+		}
+		inReplyTo = uuid.NullUUID{UUID: *params.InReplyTo, Valid: true}
+	}
+
+	// optional quoted chirp, a quote needs something to say about it
+	quoteOf := uuid.NullUUID{}
+	repostKind := sql.NullString{}
+	if params.QuoteOf != nil {
+		if strings.TrimSpace(params.Body) == "" {
+			http.Error(w, "A quote needs a body", 400)
+			return
+		}
+		original, err := cfg.repostTarget(r.Context(), *params.QuoteOf)
+		if err != nil {
+			http.Error(w, "Can't find the chirp being quoted", 404)
+			return
+		}
+		quoteOf = uuid.NullUUID{UUID: original.ID, Valid: true}
+		repostKind = sql.NullString{String: repostKindQuote, Valid: true}
+	}
+
 	// check length of json body, cannot exceed 140 chars
-	if len(params.Body) <= 140 {
+	if len(params.Body) <= maxChirpLength {
 
 		// use the helperfunction to clean up profanity
 		removed_profanity := replaceProfanity(params.Body)
 
 		// insert the chirp into the db with the sqlc generated createchirp function
 		chirp, err := cfg.db.CreateChirp(r.Context(), database.CreateChirpParams{
-			Body:   removed_profanity,
-			UserID: userID,
+			Body:       removed_profanity,
+			UserID:     userID,
+			InReplyTo:  inReplyTo,
+			RepostOf:   quoteOf,
+			RepostKind: repostKind,
 		})
 
 		if err != nil {
-			fmt.Println("%s", err)
+			fmt.Println(err)
 			http.Error(w, "Invalid chirp", 400)
 			return
 		}
 
-		// response for accepted body
-		response := responseChirp{
-			Valid:      true,
-			ID:         chirp.ID,
-			Body:       chirp.Body,
-			Created_at: chirp.CreatedAt,
-			Updated_at: chirp.UpdatedAt,
-			User_id:    chirp.UserID,
+		// index the #tags and @mentions in the body, the chirp itself is already stored either way
+		err = cfg.indexChirp(r.Context(), chirp)
+		if err != nil {
+			log.Printf("Error indexing chirp: %s", err)
+		}
+
+		// response for accepted body, nobody has liked it yet
+		viewer := uuid.NullUUID{UUID: userID, Valid: true}
+		response := chirpResponse(chirp)
+		response.Liked_by_me = new(bool)
+		response.Valid = true
+		err = cfg.hydrateChirps(r.Context(), []*responseChirp{&response}, viewer)
+		if err != nil {
+			log.Printf("Error loading quoted chirp: %s", err)
 		}
 		statusCode := 201
 		// encode response
@@ -749,49 +928,66 @@ func (cfg *apiConfig) createUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// password length checking
-	if len(params.Password) >= 4 {
-		// hash the user's password
-		hashedPw, err := auth.HashPassword(params.Password)
-		if err != nil {
-			fmt.Println("%s", err)
-		}
+	// email has to be a plain address, it gets a verification link
+	if !validEmail(params.Email) {
+		http.Error(w, "Invalid email address", 400)
+		return
+	}
 
-		// use the generated CreateUser function to create a user in the database
-		new_user, err := cfg.db.CreateUser(r.Context(), database.CreateUserParams{
-			Email:          params.Email,
-			HashedPassword: hashedPw,
-		})
-		if err != nil {
-			http.Error(w, err.Error(), 400)
-			return
-		}
+	// users who don't pick a handle get a generated one, they can change it later
+	username := params.Username
+	if username == "" {
+		username = defaultUsername()
+	} else if !validUsername(username) {
+		http.Error(w, "Username must be 3 to 30 letters, digits or underscores", 400)
+		return
+	}
 
-		// fill up the response fields with the data from the database
-		response := User{
-			Id:            new_user.ID,
-			Created_at:    new_user.CreatedAt,
-			Updated_at:    new_user.UpdatedAt,
-			Email:         new_user.Email,
-			Is_chirpy_red: new_user.IsChirpyRed,
-		}
+	if !cfg.acceptablePassword(w, params.Password, params.Email) {
+		return
+	}
 
-		// encode response
-		dat, err := json.Marshal(response)
-		if err != nil {
-			log.Printf("Error marshalling JSON: %s", err)
-			w.WriteHeader(500)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(201)
-		w.Write(dat)
-	} else {
-		// in case the password length is too short
-		http.Error(w, "Password not strong enough", 400)
+	// hash the user's password
+	hashedPw, err := cfg.passwords.Hash(params.Password)
+	if err != nil {
+		log.Printf("Error hashing password: %s", err)
+		http.Error(w, "Unable to hash password", 500)
 		return
 	}
 
+	// use the generated CreateUser function to create a user in the database
+	new_user, err := cfg.db.CreateUser(r.Context(), database.CreateUserParams{
+		Email:          params.Email,
+		HashedPassword: hashedPw,
+		Username:       username,
+	})
+	if err != nil && isUniqueViolation(err) && params.Username != "" {
+		http.Error(w, "Username is taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	err = cfg.sendVerificationEmail(new_user.ID, new_user.Email)
+	if err != nil {
+		log.Printf("Error sending verification email: %s", err)
+	}
+
+	// fill up the response fields with the data from the database
+	response := userResponse(new_user)
+
+	// encode response
+	dat, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error marshalling JSON: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(201)
+	w.Write(dat)
 }
 
 // custom handler function
@@ -824,6 +1020,58 @@ func replaceProfanity(p string) string {
 	return result
 }
 
+// maps a chirp row from the db onto the api response
+func chirpResponse(chirp database.Chirp) responseChirp {
+	response := responseChirp{
+		ID:         chirp.ID,
+		Body:       chirp.Body,
+		Created_at: chirp.CreatedAt,
+		Updated_at: chirp.UpdatedAt,
+		User_id:    chirp.UserID,
+		// created_at and updated_at are both set to NOW() on creation, only an edit moves updated_at
+		Edited: chirp.UpdatedAt.After(chirp.CreatedAt),
+	}
+	if chirp.InReplyTo.Valid {
+		response.In_reply_to = &chirp.InReplyTo.UUID
+	}
+	if chirp.RepostKind.Valid {
+		response.Repost_kind = chirp.RepostKind.String
+		response.repostOf = chirp.RepostOf
+	}
+	return response
+}
+
+// reads a duration like "24h" from the environment, falls back to def when unset or invalid
+func durationEnv(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("%s is not a valid duration, using %s", name, def)
+		return def
+	}
+
+	return d
+}
+
+func uintEnv(name string, def uint32) uint32 {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+
+	n, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || n == 0 {
+		log.Printf("%s is not a valid positive number, using %d", name, def)
+		return def
+	}
+
+	return uint32(n)
+}
+
 // helper function to reduce copying code
 func encodeResponse(w http.ResponseWriter, response responseChirp, statusCode int) {
 	dat, err := json.Marshal(response)
@@ -837,6 +1085,19 @@ func encodeResponse(w http.ResponseWriter, response responseChirp, statusCode in
 	w.Write(dat)
 }
 
+// same as encodeResponse, but for any payload (slices, other response structs)
+func encodeJSON(w http.ResponseWriter, response interface{}, statusCode int) {
+	dat, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error marshalling JSON: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(dat)
+}
+
 func (cfg *apiConfig) adminMetricsHandler(w http.ResponseWriter, r *http.Request) {
 	// set header to html so page knows how to render it
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -862,21 +1123,15 @@ func (cfg *apiConfig) adminMetricsHandler(w http.ResponseWriter, r *http.Request
 }
 
 // reset method handler that sets hitnumber to 0 and removes all the users
+// open in dev, admins only everywhere else (see main)
 func (cfg *apiConfig) resetHandler(w http.ResponseWriter, r *http.Request) {
-	if cfg.platform != "dev" {
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		// forbidden
-		w.WriteHeader(403)
-		w.Write([]byte("No permission for this endpoint"))
-	} else {
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusOK)
-		// sets hits to 0
-		cfg.fileserverHits.Store(0)
-		// delete users
-		cfg.db.Reset(r.Context())
-		w.Write([]byte("Hits reset to 0, users deleted"))
-	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	// sets hits to 0
+	cfg.fileserverHits.Store(0)
+	// delete users
+	cfg.db.Reset(r.Context())
+	w.Write([]byte("Hits reset to 0, users deleted"))
 }
 
 // middleware method that increments the fileserverHits counter every time it's called
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/peethree/chirpy/internal/database"
+)
+
+// usernames are ascii letters, digits and underscores, so @handles are easy to spot in a body
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+// postgres error code for unique constraint violations
+const uniqueViolation = "23505"
+
+// a resolved @handle, Start and End are byte offsets into the body (End exclusive)
+type responseMention struct {
+	User_id  uuid.UUID `json:"user_id"`
+	Username string    `json:"username"`
+	Start    int32     `json:"start"`
+	End      int32     `json:"end"`
+}
+
+// an @handle found in a body, not yet resolved to a user
+type mentionToken struct {
+	Username string
+	Start    int
+	End      int
+}
+
+func validUsername(username string) bool {
+	return usernamePattern.MatchString(username)
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
+// finds @handles in a chirp body, in order of appearance
+// like hashtags, a handle has to start at the beginning of the body or after a non-word character (so no foo@bar.com)
+func extractMentions(body string) []mentionToken {
+	var mentions []mentionToken
+
+	isHandleByte := func(b byte) bool {
+		return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+	}
+
+	for i := 0; i < len(body); i++ {
+		if body[i] != '@' {
+			continue
+		}
+		if i > 0 {
+			previous, _ := utf8.DecodeLastRuneInString(body[:i])
+			if previous == '_' || unicode.IsLetter(previous) || unicode.IsDigit(previous) {
+				continue
+			}
+		}
+
+		start := i
+		end := i + 1
+		for end < len(body) && isHandleByte(body[end]) {
+			end++
+		}
+
+		handle := body[start+1 : end]
+		i = end - 1
+		if !validUsername(handle) {
+			continue
+		}
+		// usernames are ascii, so a word that goes on in another script (@aliceé) is somebody else
+		next, _ := utf8.DecodeRuneInString(body[end:])
+		if next == '_' || unicode.IsLetter(next) || unicode.IsDigit(next) {
+			continue
+		}
+		mentions = append(mentions, mentionToken{Username: handle, Start: start, End: end})
+	}
+
+	return mentions
+}
+
+// (re)resolves the @handles in a chirp body, handles that don't belong to anyone are left as plain text
+func (cfg *apiConfig) mentionChirp(ctx context.Context, chirp database.Chirp) error {
+	err := cfg.db.DeleteChirpMentions(ctx, chirp.ID)
+	if err != nil {
+		return err
+	}
+
+	tokens := extractMentions(chirp.Body)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	var usernames []string
+	for _, token := range tokens {
+		usernames = append(usernames, strings.ToLower(token.Username))
+	}
+
+	users, err := cfg.db.FindUsersByUsernames(ctx, usernames)
+	if err != nil {
+		return err
+	}
+
+	userIDs := map[string]uuid.UUID{}
+	for _, user := range users {
+		userIDs[strings.ToLower(user.Username)] = user.ID
+	}
+
+	params := database.CreateChirpMentionsParams{ChirpID: chirp.ID}
+	for _, token := range tokens {
+		userID, ok := userIDs[strings.ToLower(token.Username)]
+		if !ok {
+			continue
+		}
+		params.UserIds = append(params.UserIds, userID)
+		params.StartOffsets = append(params.StartOffsets, int32(token.Start))
+		params.EndOffsets = append(params.EndOffsets, int32(token.End))
+	}
+	if len(params.UserIds) == 0 {
+		return nil
+	}
+
+	return cfg.db.CreateChirpMentions(ctx, params)
+}
+
+// everything derived from a chirp body: #tags and @mentions
+func (cfg *apiConfig) indexChirp(ctx context.Context, chirp database.Chirp) error {
+	err := cfg.tagChirp(ctx, chirp)
+	if err != nil {
+		return err
+	}
+	return cfg.mentionChirp(ctx, chirp)
+}
+
+// fills in Mentions for every chirp, with one query for all of them
+func (cfg *apiConfig) embedMentions(ctx context.Context, chirps []*responseChirp) error {
+	var ids []uuid.UUID
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.ID)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := cfg.db.LoadChirpMentions(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	mentions := map[uuid.UUID][]responseMention{}
+	for _, row := range rows {
+		mentions[row.ChirpID] = append(mentions[row.ChirpID], responseMention{
+			User_id:  row.UserID,
+			Username: row.Username,
+			Start:    row.StartOffset,
+			End:      row.EndOffset,
+		})
+	}
+
+	for _, chirp := range chirps {
+		chirp.Mentions = mentions[chirp.ID]
+		if chirp.Mentions == nil {
+			chirp.Mentions = []responseMention{}
+		}
+	}
+
+	return nil
+}
+
+// everything a chirp response needs besides the chirp row itself: embedded originals and mentions
+func (cfg *apiConfig) hydrateChirps(ctx context.Context, chirps []*responseChirp, viewer uuid.NullUUID) error {
+	err := cfg.embedOriginals(ctx, chirps, viewer)
+	if err != nil {
+		return err
+	}
+
+	// originals carry mentions of their own
+	all := chirps
+	for _, chirp := range chirps {
+		if chirp.Original != nil && chirp.Original.responseChirp != nil {
+			all = append(all, chirp.Original.responseChirp)
+		}
+	}
+
+	return cfg.embedMentions(ctx, all)
+}
+
+// chirps mentioning the authenticated user, newest first
+func (cfg *apiConfig) mentionsHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := cfg.authenticate(w, r, scopeTimelineRead)
+	if !ok {
+		return
+	}
+	userID := c.userID
+
+	page, err := parsePageParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	cursorCreatedAt, cursorID := page.cursorArgs()
+
+	chirps, err := cfg.db.LoadMentionsPage(r.Context(), database.LoadMentionsPageParams{
+		UserID:          userID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		log.Printf("Error loading mentions: %s", err)
+		http.Error(w, "Unable to load mentions", 500)
+		return
+	}
+
+	chirps, next := paginate(chirps, page.Limit, func(chirp database.LoadMentionsPageRow) pageCursor {
+		return pageCursor{CreatedAt: chirp.CreatedAt, ID: chirp.ID}
+	})
+
+	viewer := uuid.NullUUID{UUID: userID, Valid: true}
+	response := []responseChirp{}
+	for _, chirp := range chirps {
+		response = append(response, likedChirpResponse(loadedChirp(chirp), viewer))
+	}
+
+	err = cfg.hydrateChirps(r.Context(), chirpRefs(response), viewer)
+	if err != nil {
+		log.Printf("Error hydrating chirps: %s", err)
+		http.Error(w, "Unable to load mentions", 500)
+		return
+	}
+
+	setNextPageLink(w, r, next)
+	encodeJSON(w, response, 200)
+}
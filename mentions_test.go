@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []mentionToken
+	}{
+		{name: "No mentions", body: "nothing to see here"},
+		{name: "At the start", body: "@alice hi", want: []mentionToken{{Username: "alice", Start: 0, End: 6}}},
+		{name: "Punctuation ends a handle", body: "hi @bob_1! and @carol's", want: []mentionToken{
+			{Username: "bob_1", Start: 3, End: 9},
+			{Username: "carol", Start: 15, End: 21},
+		}},
+		{name: "In parentheses", body: "(@alice)", want: []mentionToken{{Username: "alice", Start: 1, End: 7}}},
+		{name: "Duplicates are kept in order", body: "@alice @alice", want: []mentionToken{
+			{Username: "alice", Start: 0, End: 6},
+			{Username: "alice", Start: 7, End: 13},
+		}},
+		{name: "Email address", body: "mail a@b.com or alice@example.com", want: nil},
+		{name: "Not after a multibyte letter", body: "é@alice", want: nil},
+		{name: "Double at", body: "@@alice", want: []mentionToken{{Username: "alice", Start: 1, End: 7}}},
+		{name: "Followed by a multibyte letter", body: "@aliceé and @alice日本 and @alice٣", want: nil},
+		{name: "Followed by multibyte punctuation", body: "@alice… @bob🎉", want: []mentionToken{
+			{Username: "alice", Start: 0, End: 6},
+			{Username: "bob", Start: 10, End: 14},
+		}},
+		{name: "Too short", body: "@ab", want: nil},
+		{name: "Too long", body: "@" + strings.Repeat("a", 31), want: nil},
+		{name: "Byte offsets after multibyte text", body: "héllo @bob", want: []mentionToken{{Username: "bob", Start: 7, End: 11}}},
+		{name: "Byte offsets after CJK text", body: "日本 @alice 🎉 @bob", want: []mentionToken{
+			{Username: "alice", Start: 7, End: 13},
+			{Username: "bob", Start: 19, End: 23},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extractMentions(tt.body)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractMentions(%q) = %+v, want %+v", tt.body, got, tt.want)
+			}
+			for _, mention := range got {
+				if tt.body[mention.Start:mention.End] != "@"+mention.Username {
+					t.Errorf("body[%d:%d] = %q, want %q", mention.Start, mention.End, tt.body[mention.Start:mention.End], "@"+mention.Username)
+				}
+			}
+		})
+	}
+}
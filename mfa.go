@@ -0,0 +1,432 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/peethree/chirpy/internal/auth"
+	"github.com/peethree/chirpy/internal/database"
+)
+
+const (
+	// the challenge token from a password login is only good for redeeming a code at /api/login/mfa
+	mfaPurpose      = "mfa"
+	mfaChallengeTTL = 5 * time.Minute
+	// shown as the account's issuer in authenticator apps
+	totpIssuer        = "Chirpy"
+	recoveryCodeCount = 10
+	// every maxMFAAttempts wrong codes in a row lock the second factor for mfaLockDuration
+	maxMFAAttempts  = 5
+	mfaLockDuration = 15 * time.Minute
+)
+
+var (
+	errMFALocked  = errors.New("too many wrong codes")
+	errMFAInvalid = errors.New("wrong code")
+)
+
+// struct for responding to a password login of a user with two-factor authentication
+type responseMFAChallenge struct {
+	Mfa_required bool   `json:"mfa_required"`
+	Mfa_token    string `json:"mfa_token"`
+}
+
+// struct for responding to api/mfa/totp/enroll
+type responseTOTPEnrollment struct {
+	Secret      string `json:"secret"`
+	Otpauth_uri string `json:"otpauth_uri"`
+}
+
+// struct for responding with new recovery codes, they are only ever shown once
+type responseRecoveryCodes struct {
+	Recovery_codes []string `json:"recovery_codes"`
+}
+
+// struct for requests that need a TOTP or recovery code
+type requestMFACode struct {
+	Code string `json:"code"`
+}
+
+// struct for redeeming a challenge on api/login/mfa
+type requestMFALogin struct {
+	Mfa_token string `json:"mfa_token"`
+	Code      string `json:"code"`
+}
+
+// recovery codes are short, so they're stored keyed with the mfa key: a leaked table alone can't be brute forced
+func (cfg *apiConfig) hashRecoveryCode(userID uuid.UUID, code string) string {
+	mac := hmac.New(sha256.New, cfg.mfaKey)
+	mac.Write(userID[:])
+	mac.Write([]byte(auth.NormalizeRecoveryCode(code)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// the user's TOTP secret, decrypted
+func (cfg *apiConfig) totpSecret(user database.User) ([]byte, error) {
+	if cfg.mfaKey == nil {
+		return nil, errors.New("MFA_ENCRYPTION_KEY is not set")
+	}
+	return auth.DecryptSecret(cfg.mfaKey, user.TotpSecret, user.ID[:])
+}
+
+// replaces all recovery codes of the user, returning the new ones in plain text
+func (cfg *apiConfig) replaceRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = cfg.hashRecoveryCode(userID, code)
+	}
+
+	err = cfg.db.DeleteRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.db.CreateRecoveryCodes(ctx, database.CreateRecoveryCodesParams{
+		UserID:     userID,
+		CodeHashes: hashes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// checks a TOTP code, or else a recovery code, and uses it up
+func (cfg *apiConfig) verifySecondFactor(ctx context.Context, user database.User, code string) error {
+	if user.MfaLockedUntil.Valid && user.MfaLockedUntil.Time.After(time.Now()) {
+		return errMFALocked
+	}
+
+	secret, err := cfg.totpSecret(user)
+	if err != nil {
+		return err
+	}
+
+	verified := false
+	if step, ok := auth.ValidateTOTP(secret, code, time.Now(), user.TotpLastStep); ok {
+		// only counts if no request used this step in the meantime
+		used, err := cfg.db.UseTOTPStep(ctx, database.UseTOTPStepParams{ID: user.ID, TotpLastStep: step})
+		if err != nil {
+			return err
+		}
+		verified = used == 1
+	} else {
+		used, err := cfg.db.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			UserID:   user.ID,
+			CodeHash: cfg.hashRecoveryCode(user.ID, code),
+		})
+		if err != nil {
+			return err
+		}
+		verified = used == 1
+	}
+
+	if !verified {
+		err = cfg.db.RecordMFAFailure(ctx, database.RecordMFAFailureParams{
+			MaxAttempts: maxMFAAttempts,
+			LockSeconds: mfaLockDuration.Seconds(),
+			ID:          user.ID,
+		})
+		if err != nil {
+			log.Printf("Error recording mfa failure: %s", err)
+		}
+		return errMFAInvalid
+	}
+
+	if user.MfaFailedAttempts > 0 {
+		err = cfg.db.ResetMFAFailures(ctx, user.ID)
+		if err != nil {
+			log.Printf("Error resetting mfa failures: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// responds to a failed verifySecondFactor
+func secondFactorError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errMFALocked):
+		w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(mfaLockDuration.Seconds()))))
+		http.Error(w, "Too many wrong codes, try again later", http.StatusTooManyRequests)
+	case errors.Is(err, errMFAInvalid):
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+	default:
+		log.Printf("Error verifying second factor: %s", err)
+		http.Error(w, "Unable to verify code", 500)
+	}
+}
+
+// answers a correct password with a challenge instead of tokens
+func (cfg *apiConfig) mfaChallenge(w http.ResponseWriter, user database.User) {
+	challenge, err := cfg.makeMFAChallenge(user)
+	if err != nil {
+		log.Printf("Error making mfa challenge: %s", err)
+		http.Error(w, "Unable to make a token", 500)
+		return
+	}
+
+	encodeJSON(w, challenge, 200)
+}
+
+// the challenge for the second step of logging user in
+func (cfg *apiConfig) makeMFAChallenge(user database.User) (responseMFAChallenge, error) {
+	token, err := cfg.keys.MakePurposeJWT(mfaPurpose, user.ID, "", mfaChallengeTTL)
+	if err != nil {
+		return responseMFAChallenge{}, err
+	}
+
+	return responseMFAChallenge{Mfa_required: true, Mfa_token: token}, nil
+}
+
+// second step of logging in with two-factor authentication
+func (cfg *apiConfig) loginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	params := requestMFALogin{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		http.Error(w, "Invalid Json", 400)
+		return
+	}
+
+	claims, err := cfg.keys.ValidatePurposeJWT(params.Mfa_token, mfaPurpose)
+	if err != nil {
+		http.Error(w, "Invalid or expired mfa token, log in again", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		http.Error(w, "Invalid or expired mfa token, log in again", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := cfg.db.FindUserById(r.Context(), userID)
+	if err != nil || !user.TotpEnabledAt.Valid {
+		http.Error(w, "Invalid or expired mfa token, log in again", http.StatusUnauthorized)
+		return
+	}
+
+	err = cfg.verifySecondFactor(r.Context(), user, params.Code)
+	if err != nil {
+		secondFactorError(w, err)
+		return
+	}
+
+	cfg.completeLogin(w, r, user)
+}
+
+// the bearer-token user, for the mfa settings endpoints
+func (cfg *apiConfig) mfaUser(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+	if cfg.mfaKey == nil {
+		http.Error(w, "Two-factor authentication is not configured", http.StatusServiceUnavailable)
+		return database.User{}, false
+	}
+
+	c, ok := cfg.authenticate(w, r, scopeSessionOnly)
+	if !ok {
+		return database.User{}, false
+	}
+	userID := c.userID
+
+	user, err := cfg.db.FindUserById(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Unable to find user", 404)
+		return database.User{}, false
+	}
+
+	return user, true
+}
+
+// starts enrollment: a new secret the user adds to their authenticator app, not active until confirmed
+func (cfg *apiConfig) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.mfaUser(w, r)
+	if !ok {
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("Error generating totp secret: %s", err)
+		http.Error(w, "Unable to enroll", 500)
+		return
+	}
+
+	// bound to the user's id, so the ciphertext is useless in another row
+	encrypted, err := auth.EncryptSecret(cfg.mfaKey, secret, user.ID[:])
+	if err != nil {
+		log.Printf("Error encrypting totp secret: %s", err)
+		http.Error(w, "Unable to enroll", 500)
+		return
+	}
+
+	err = cfg.db.SetTOTPSecret(r.Context(), database.SetTOTPSecretParams{ID: user.ID, TotpSecret: encrypted})
+	if err != nil {
+		log.Printf("Error storing totp secret: %s", err)
+		http.Error(w, "Unable to enroll", 500)
+		return
+	}
+
+	response := responseTOTPEnrollment{
+		Secret:      auth.EncodeTOTPSecret(secret),
+		Otpauth_uri: auth.TOTPURI(totpIssuer, user.Email, secret),
+	}
+
+	encodeJSON(w, response, 200)
+}
+
+// finishes enrollment with a first code from the app, and hands out the recovery codes
+func (cfg *apiConfig) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.mfaUser(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := requestMFACode{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		http.Error(w, "Invalid Json", 400)
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if user.TotpSecret == nil {
+		http.Error(w, "Start enrollment first", 400)
+		return
+	}
+
+	secret, err := cfg.totpSecret(user)
+	if err != nil {
+		log.Printf("Error decrypting totp secret: %s", err)
+		http.Error(w, "Unable to confirm", 500)
+		return
+	}
+
+	step, valid := auth.ValidateTOTP(secret, params.Code, time.Now(), 0)
+	if !valid {
+		http.Error(w, "Invalid code", 400)
+		return
+	}
+
+	enabled, err := cfg.db.EnableTOTP(r.Context(), database.EnableTOTPParams{ID: user.ID, TotpLastStep: step})
+	if err != nil {
+		log.Printf("Error enabling totp: %s", err)
+		http.Error(w, "Unable to confirm", 500)
+		return
+	}
+	if enabled == 0 {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	codes, err := cfg.replaceRecoveryCodes(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error creating recovery codes: %s", err)
+		http.Error(w, "Unable to create recovery codes", 500)
+		return
+	}
+
+	encodeJSON(w, responseRecoveryCodes{Recovery_codes: codes}, 200)
+}
+
+// turns two-factor authentication off, needs a current code
+func (cfg *apiConfig) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.mfaUser(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := requestMFACode{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		http.Error(w, "Invalid Json", 400)
+		return
+	}
+
+	if !user.TotpEnabledAt.Valid {
+		http.Error(w, "Two-factor authentication is not enabled", 400)
+		return
+	}
+
+	err = cfg.verifySecondFactor(r.Context(), user, params.Code)
+	if err != nil {
+		secondFactorError(w, err)
+		return
+	}
+
+	err = cfg.db.DisableTOTP(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error disabling totp: %s", err)
+		http.Error(w, "Unable to disable two-factor authentication", 500)
+		return
+	}
+
+	err = cfg.db.DeleteRecoveryCodes(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error deleting recovery codes: %s", err)
+	}
+
+	w.WriteHeader(204)
+}
+
+// replaces the recovery codes, needs a current code
+func (cfg *apiConfig) recoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.mfaUser(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := requestMFACode{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		http.Error(w, "Invalid Json", 400)
+		return
+	}
+
+	if !user.TotpEnabledAt.Valid {
+		http.Error(w, "Two-factor authentication is not enabled", 400)
+		return
+	}
+
+	err = cfg.verifySecondFactor(r.Context(), user, params.Code)
+	if err != nil {
+		secondFactorError(w, err)
+		return
+	}
+
+	codes, err := cfg.replaceRecoveryCodes(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error creating recovery codes: %s", err)
+		http.Error(w, "Unable to create recovery codes", 500)
+		return
+	}
+
+	encodeJSON(w, responseRecoveryCodes{Recovery_codes: codes}, 200)
+}
@@ -0,0 +1,794 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/peethree/chirpy/internal/auth"
+	"github.com/peethree/chirpy/internal/database"
+)
+
+const (
+	// authorization codes are traded for tokens right after the redirect
+	oauthCodeTTL = 10 * time.Minute
+	// confidential clients get a secret like this, shown once on registration
+	clientSecretPrefix   = "chirpy_cs_"
+	maxClientNameLength  = 100
+	maxClientRedirectURI = 10
+)
+
+// what the consent page tells the user about each scope
+var scopeDescriptions = map[string]string{
+	scopeChirpsWrite:  "Post, edit and rechirp chirps as you",
+	scopeChirpsDelete: "Delete your chirps and rechirps",
+	scopeLikesWrite:   "Like and unlike chirps as you",
+	scopeFollowsWrite: "Follow and unfollow users as you",
+	scopeTimelineRead: "Read your home timeline and mentions",
+	scopeProfileWrite: "Change your profile (not your email address or password)",
+}
+
+var errInvalidClient = errors.New("invalid client")
+
+// struct for registering a client on POST api/oauth/clients
+type requestOAuthClient struct {
+	Name          string   `json:"name"`
+	Redirect_uris []string `json:"redirect_uris"`
+	// confidential clients (servers) get a secret, public clients (mobile and browser apps) rely on PKCE alone
+	Confidential bool `json:"confidential"`
+}
+
+// struct for responding with a client, Client_secret is only set right after registering it
+type responseOAuthClient struct {
+	Client_id     string    `json:"client_id"`
+	Client_secret string    `json:"client_secret,omitempty"`
+	Name          string    `json:"name"`
+	Redirect_uris []string  `json:"redirect_uris"`
+	Confidential  bool      `json:"confidential"`
+	Created_at    time.Time `json:"created_at"`
+}
+
+// struct for responding to oauth/token (RFC 6749 section 5.1)
+type responseOAuthToken struct {
+	Access_token  string `json:"access_token"`
+	Token_type    string `json:"token_type"`
+	Expires_in    int    `json:"expires_in"`
+	Refresh_token string `json:"refresh_token"`
+	Scope         string `json:"scope"`
+}
+
+// struct for OAuth error responses (RFC 6749 section 5.2)
+type responseOAuthError struct {
+	Error             string `json:"error"`
+	Error_description string `json:"error_description,omitempty"`
+}
+
+// struct for responding to oauth/introspect (RFC 7662), everything but Active is left out for inactive tokens
+type responseIntrospection struct {
+	Active     bool   `json:"active"`
+	Scope      string `json:"scope,omitempty"`
+	Client_id  string `json:"client_id,omitempty"`
+	Sub        string `json:"sub,omitempty"`
+	Token_type string `json:"token_type,omitempty"`
+	Exp        int64  `json:"exp,omitempty"`
+	Iat        int64  `json:"iat,omitempty"`
+}
+
+func oauthClientResponse(client database.OauthClient) responseOAuthClient {
+	return responseOAuthClient{
+		Client_id:     client.ID,
+		Name:          client.Name,
+		Redirect_uris: strings.Fields(client.RedirectUris),
+		Confidential:  client.SecretHash.Valid,
+		Created_at:    client.CreatedAt,
+	}
+}
+
+// https anywhere, plain http only back to the same machine (RFC 8252 loopback redirects for native apps)
+func validRedirectURI(raw string) bool {
+	redirect, err := url.Parse(raw)
+	if err != nil || redirect.Host == "" || redirect.Fragment != "" || redirect.User != nil {
+		return false
+	}
+
+	switch redirect.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := redirect.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	}
+
+	return false
+}
+
+// registers an app that can ask users for access
+func (cfg *apiConfig) createOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := cfg.authenticate(w, r, scopeSessionOnly)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := requestOAuthClient{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		http.Error(w, "Invalid Json", 400)
+		return
+	}
+
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" || utf8.RuneCountInString(params.Name) > maxClientNameLength {
+		http.Error(w, fmt.Sprintf("Client name must be 1 to %d characters", maxClientNameLength), 400)
+		return
+	}
+
+	if len(params.Redirect_uris) == 0 || len(params.Redirect_uris) > maxClientRedirectURI {
+		http.Error(w, fmt.Sprintf("A client needs 1 to %d redirect uris", maxClientRedirectURI), 400)
+		return
+	}
+	redirectURIs := []string{}
+	for _, redirectURI := range params.Redirect_uris {
+		// the list is stored space separated, a valid url has no spaces
+		if !validRedirectURI(redirectURI) || strings.ContainsAny(redirectURI, " \t\n") {
+			http.Error(w, fmt.Sprintf("Invalid redirect uri %q, it must be https (or http to localhost) without a fragment", redirectURI), 400)
+			return
+		}
+		if !slices.Contains(redirectURIs, redirectURI) {
+			redirectURIs = append(redirectURIs, redirectURI)
+		}
+	}
+
+	secret := ""
+	secretHash := sql.NullString{}
+	if params.Confidential {
+		random, err := auth.MakeRefreshToken()
+		if err != nil {
+			log.Printf("Error making client secret: %s", err)
+			http.Error(w, "Unable to register client", 500)
+			return
+		}
+		secret = clientSecretPrefix + random
+		secretHash = sql.NullString{String: auth.HashRefreshToken(secret), Valid: true}
+	}
+
+	client, err := cfg.db.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		ID:           uuid.NewString(),
+		SecretHash:   secretHash,
+		Name:         params.Name,
+		RedirectUris: strings.Join(redirectURIs, " "),
+		OwnerID:      c.userID,
+	})
+	if err != nil {
+		log.Printf("Error storing client: %s", err)
+		http.Error(w, "Unable to register client", 500)
+		return
+	}
+
+	response := oauthClientResponse(client)
+	response.Client_secret = secret
+
+	encodeJSON(w, response, 201)
+}
+
+// lists the clients the user registered
+func (cfg *apiConfig) oauthClientsHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := cfg.authenticate(w, r, scopeSessionOnly)
+	if !ok {
+		return
+	}
+
+	clients, err := cfg.db.LoadOAuthClients(r.Context(), c.userID)
+	if err != nil {
+		log.Printf("Error loading clients: %s", err)
+		http.Error(w, "Unable to load clients", 500)
+		return
+	}
+
+	response := make([]responseOAuthClient, 0, len(clients))
+	for _, client := range clients {
+		response = append(response, oauthClientResponse(client))
+	}
+
+	encodeJSON(w, response, 200)
+}
+
+// deletes a client the user registered, every token it got stops working
+func (cfg *apiConfig) deleteOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := cfg.authenticate(w, r, scopeSessionOnly)
+	if !ok {
+		return
+	}
+
+	deleted, err := cfg.db.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID:      r.PathValue("clientID"),
+		OwnerID: c.userID,
+	})
+	if err != nil {
+		log.Printf("Error deleting client: %s", err)
+		http.Error(w, "Unable to delete client", 500)
+		return
+	}
+	if deleted == 0 {
+		http.Error(w, "Unable to find client", 404)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// a validated authorization request, from the query of GET oauth/authorize or the consent form
+type authorizeRequest struct {
+	client        database.OauthClient
+	redirectURI   string
+	scope         string
+	state         string
+	codeChallenge string
+}
+
+// a problem with an authorization request. Once the redirect uri is known to belong to the client
+// the error goes back to the client (redirect), before that it can only be shown to the user
+type authorizeError struct {
+	redirect    bool
+	code        string
+	description string
+}
+
+func (e *authorizeError) Error() string {
+	return e.description
+}
+
+func (cfg *apiConfig) parseAuthorizeRequest(r *http.Request, values url.Values) (authorizeRequest, error) {
+	req := authorizeRequest{
+		redirectURI:   values.Get("redirect_uri"),
+		state:         values.Get("state"),
+		codeChallenge: values.Get("code_challenge"),
+	}
+
+	client, err := cfg.db.FindOAuthClient(r.Context(), values.Get("client_id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		return req, &authorizeError{description: "Unknown client"}
+	}
+	if err != nil {
+		return req, err
+	}
+	req.client = client
+
+	// never redirect anywhere the client didn't register
+	if !slices.Contains(strings.Fields(client.RedirectUris), req.redirectURI) {
+		return req, &authorizeError{description: "The redirect uri isn't registered for this client"}
+	}
+
+	if values.Get("response_type") != "code" {
+		return req, &authorizeError{redirect: true, code: "unsupported_response_type", description: "Only response_type=code is supported"}
+	}
+
+	if req.codeChallenge == "" || values.Get("code_challenge_method") != "S256" {
+		return req, &authorizeError{redirect: true, code: "invalid_request", description: "PKCE with code_challenge_method=S256 is required"}
+	}
+
+	scopes := []string{}
+	for _, scope := range strings.Fields(values.Get("scope")) {
+		if !slices.Contains(tokenScopes, scope) {
+			return req, &authorizeError{redirect: true, code: "invalid_scope", description: fmt.Sprintf("Unknown scope %q", scope)}
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return req, &authorizeError{redirect: true, code: "invalid_scope", description: "At least one scope is required"}
+	}
+	req.scope = strings.Join(scopes, " ")
+
+	return req, nil
+}
+
+// sends the user back to the client with params added to the redirect uri's query
+func redirectToClient(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	redirect, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "Invalid redirect uri", 400)
+		return
+	}
+
+	query := redirect.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	redirect.RawQuery = query.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// answers an authorization request that can't go on: to the client when possible, otherwise on a page for the user
+func (cfg *apiConfig) authorizeFailed(w http.ResponseWriter, r *http.Request, req authorizeRequest, err error) {
+	var authErr *authorizeError
+	if !errors.As(err, &authErr) {
+		log.Printf("Error handling authorization request: %s", err)
+		renderAuthorizeError(w, "Something went wrong, try again later", 500)
+		return
+	}
+
+	if !authErr.redirect {
+		renderAuthorizeError(w, authErr.description, 400)
+		return
+	}
+
+	params := url.Values{"error": {authErr.code}, "error_description": {authErr.description}}
+	if req.state != "" {
+		params.Set("state", req.state)
+	}
+	redirectToClient(w, r, req.redirectURI, params)
+}
+
+// shows the consent page for an authorization request
+func (cfg *apiConfig) authorizeHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := cfg.parseAuthorizeRequest(r, r.URL.Query())
+	if err != nil {
+		cfg.authorizeFailed(w, r, req, err)
+		return
+	}
+
+	renderConsent(w, req, "", "", 200)
+}
+
+// the consent form: the user logs in and approves or denies the client
+func (cfg *apiConfig) approveAuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		renderAuthorizeError(w, "Invalid form", 400)
+		return
+	}
+
+	// the hidden fields could have been changed, so they're checked all over again
+	req, err := cfg.parseAuthorizeRequest(r, r.PostForm)
+	if err != nil {
+		cfg.authorizeFailed(w, r, req, err)
+		return
+	}
+
+	if r.PostForm.Get("decision") != "approve" {
+		cfg.authorizeFailed(w, r, req, &authorizeError{redirect: true, code: "access_denied", description: "The user denied access"})
+		return
+	}
+
+	email := r.PostForm.Get("email")
+	user, err := cfg.checkCredentials(r, email, r.PostForm.Get("password"))
+	var locked loginLockedError
+	if errors.As(err, &locked) {
+		renderConsent(w, req, email, "Too many failed logins, try again later", http.StatusTooManyRequests)
+		return
+	}
+	if errors.Is(err, errIncorrectCredentials) {
+		renderConsent(w, req, email, "Incorrect email or password", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		cfg.authorizeFailed(w, r, req, err)
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		err = cfg.verifySecondFactor(r.Context(), user, r.PostForm.Get("code"))
+		if errors.Is(err, errMFALocked) {
+			renderConsent(w, req, email, "Too many wrong two-factor codes, try again later", http.StatusTooManyRequests)
+			return
+		}
+		if errors.Is(err, errMFAInvalid) {
+			renderConsent(w, req, email, "Your account needs a valid two-factor code", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			cfg.authorizeFailed(w, r, req, err)
+			return
+		}
+	}
+
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		cfg.authorizeFailed(w, r, req, err)
+		return
+	}
+
+	err = cfg.db.CreateAuthorizationCode(r.Context(), database.CreateAuthorizationCodeParams{
+		CodeHash:      auth.HashRefreshToken(code),
+		ClientID:      req.client.ID,
+		UserID:        user.ID,
+		RedirectUri:   req.redirectURI,
+		Scopes:        req.scope,
+		CodeChallenge: req.codeChallenge,
+		TtlSeconds:    oauthCodeTTL.Seconds(),
+	})
+	if err != nil {
+		cfg.authorizeFailed(w, r, req, err)
+		return
+	}
+
+	params := url.Values{"code": {code}}
+	if req.state != "" {
+		params.Set("state", req.state)
+	}
+	redirectToClient(w, r, req.redirectURI, params)
+}
+
+// the client making a request to the token, introspection or revocation endpoint,
+// with HTTP basic auth or client_id and client_secret in the form
+func (cfg *apiConfig) authenticateClient(r *http.Request) (database.OauthClient, error) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	client, err := cfg.db.FindOAuthClient(r.Context(), clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return client, errInvalidClient
+	}
+	if err != nil {
+		return client, err
+	}
+
+	// public clients have no secret to check, PKCE takes its place
+	if !client.SecretHash.Valid {
+		if secret != "" {
+			return client, errInvalidClient
+		}
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(auth.HashRefreshToken(secret)), []byte(client.SecretHash.String)) != 1 {
+		return client, errInvalidClient
+	}
+
+	return client, nil
+}
+
+func oauthError(w http.ResponseWriter, code, description string, statusCode int) {
+	w.Header().Set("Cache-Control", "no-store")
+	if code == "invalid_client" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+	encodeJSON(w, responseOAuthError{Error: code, Error_description: description}, statusCode)
+}
+
+// responds to a failed authenticateClient
+func clientAuthFailed(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInvalidClient) {
+		oauthError(w, "invalid_client", "Unknown client or wrong client secret", http.StatusUnauthorized)
+		return
+	}
+	log.Printf("Error authenticating client: %s", err)
+	oauthError(w, "server_error", "", 500)
+}
+
+// trades an authorization code or a refresh token for tokens
+func (cfg *apiConfig) oauthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		oauthError(w, "invalid_request", "Invalid form", 400)
+		return
+	}
+
+	client, err := cfg.authenticateClient(r)
+	if err != nil {
+		clientAuthFailed(w, err)
+		return
+	}
+
+	var s session
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		var ok bool
+		s, ok = cfg.exchangeAuthorizationCode(w, r, client)
+		if !ok {
+			return
+		}
+
+	case "refresh_token":
+		// same rotation as api/refresh, a reused refresh token revokes the whole authorization
+		s, err = cfg.rotateSession(r.Context(), r.PostForm.Get("refresh_token"), sql.NullString{String: client.ID, Valid: true})
+		if errors.Is(err, errRefreshTokenReused) || errors.Is(err, errRefreshTokenInvalid) {
+			oauthError(w, "invalid_grant", "Refresh token is invalid, expired or already used", 400)
+			return
+		}
+		if err != nil {
+			log.Printf("Error rotating refresh token: %s", err)
+			oauthError(w, "server_error", "", 500)
+			return
+		}
+
+	default:
+		oauthError(w, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token", 400)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	encodeJSON(w, responseOAuthToken{
+		Access_token:  s.AccessToken,
+		Token_type:    "Bearer",
+		Expires_in:    int(accessTokenTTL.Seconds()),
+		Refresh_token: s.RefreshToken,
+		Scope:         s.Scopes,
+	}, 200)
+}
+
+// trades an authorization code for the first tokens of a new token family, writing the error response when it can't
+// the code is only used up once the request proved it's the client's (redirect uri and PKCE),
+// so whoever merely saw the code can't void it
+func (cfg *apiConfig) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client database.OauthClient) (session, bool) {
+	codeHash := auth.HashRefreshToken(r.PostForm.Get("code"))
+	code, err := cfg.db.FindAuthorizationCode(r.Context(), codeHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		oauthError(w, "invalid_grant", "Authorization code is invalid, expired or already used", 400)
+		return session{}, false
+	}
+	if err != nil {
+		log.Printf("Error finding authorization code: %s", err)
+		oauthError(w, "server_error", "", 500)
+		return session{}, false
+	}
+
+	if code.ClientID != client.ID || code.RedirectUri != r.PostForm.Get("redirect_uri") {
+		oauthError(w, "invalid_grant", "Authorization code was issued to another client or redirect uri", 400)
+		return session{}, false
+	}
+	if !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		oauthError(w, "invalid_grant", "code_verifier doesn't match the code_challenge", 400)
+		return session{}, false
+	}
+
+	// a code exchanged twice was seen by someone else, the tokens from the first exchange go too (RFC 6749 4.1.2)
+	if code.UsedAt.Valid {
+		if code.FamilyID.Valid {
+			err = cfg.db.RevokeTokenFamily(r.Context(), code.FamilyID.UUID)
+			if err != nil {
+				log.Printf("Error revoking token family of a replayed code: %s", err)
+			}
+		}
+		oauthError(w, "invalid_grant", "Authorization code is invalid, expired or already used", 400)
+		return session{}, false
+	}
+
+	// no row when it expired, or a concurrent exchange of the same code got there first
+	_, err = cfg.db.UseAuthorizationCode(r.Context(), codeHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		oauthError(w, "invalid_grant", "Authorization code is invalid, expired or already used", 400)
+		return session{}, false
+	}
+	if err != nil {
+		log.Printf("Error using authorization code: %s", err)
+		oauthError(w, "server_error", "", 500)
+		return session{}, false
+	}
+
+	s, err := cfg.startClientSession(r, code.UserID, client.ID, code.Scopes)
+	if err != nil {
+		log.Printf("Error starting client session: %s", err)
+		oauthError(w, "server_error", "", 500)
+		return session{}, false
+	}
+
+	err = cfg.db.SetAuthorizationCodeFamily(r.Context(), database.SetAuthorizationCodeFamilyParams{
+		CodeHash: codeHash,
+		FamilyID: uuid.NullUUID{UUID: s.FamilyID, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Error storing token family of authorization code: %s", err)
+	}
+
+	return s, true
+}
+
+// tells a confidential client whether one of its tokens is live, and what it's for
+func (cfg *apiConfig) oauthIntrospectHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		oauthError(w, "invalid_request", "Invalid form", 400)
+		return
+	}
+
+	client, err := cfg.authenticateClient(r)
+	if err == nil && !client.SecretHash.Valid {
+		err = errInvalidClient
+	}
+	if err != nil {
+		clientAuthFailed(w, err)
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	response := responseIntrospection{}
+
+	// a client only learns about its own tokens, anything else is inactive
+	if strings.Count(token, ".") == 2 {
+		claims, err := cfg.keys.ValidateAccessToken(token)
+		if err == nil && claims.ClientID == client.ID {
+			response = responseIntrospection{
+				Active:     true,
+				Scope:      claims.Scope,
+				Client_id:  claims.ClientID,
+				Sub:        claims.Subject,
+				Token_type: "Bearer",
+				Exp:        claims.ExpiresAt.Unix(),
+			}
+			if claims.IssuedAt != nil {
+				response.Iat = claims.IssuedAt.Unix()
+			}
+		}
+	} else if token != "" {
+		refreshToken, err := cfg.db.FindRefreshToken(r.Context(), auth.HashRefreshToken(token))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error looking up refresh token: %s", err)
+			oauthError(w, "server_error", "", 500)
+			return
+		}
+		if err == nil && !refreshToken.RevokedAt.Valid && refreshToken.ExpiresAt.After(time.Now()) && refreshToken.ClientID.String == client.ID {
+			response = responseIntrospection{
+				Active:     true,
+				Scope:      refreshToken.Scopes,
+				Client_id:  client.ID,
+				Sub:        refreshToken.UserID.String(),
+				Token_type: "refresh_token",
+				Exp:        refreshToken.ExpiresAt.Unix(),
+				Iat:        refreshToken.CreatedAt.Unix(),
+			}
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	encodeJSON(w, response, 200)
+}
+
+// revokes a refresh token of the client and its whole authorization (RFC 7009)
+// access tokens can't be revoked, they run out within accessTokenTTL
+func (cfg *apiConfig) oauthRevokeHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		oauthError(w, "invalid_request", "Invalid form", 400)
+		return
+	}
+
+	client, err := cfg.authenticateClient(r)
+	if err != nil {
+		clientAuthFailed(w, err)
+		return
+	}
+
+	refreshToken, err := cfg.db.FindRefreshToken(r.Context(), auth.HashRefreshToken(r.PostForm.Get("token")))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error looking up refresh token: %s", err)
+		oauthError(w, "server_error", "", 500)
+		return
+	}
+
+	// unknown tokens and tokens of other clients get the same answer
+	if err == nil && refreshToken.ClientID.Valid && refreshToken.ClientID.String == client.ID {
+		err = cfg.db.RevokeTokenFamily(r.Context(), refreshToken.FamilyID)
+		if err != nil {
+			log.Printf("Error revoking refresh tokens: %s", err)
+			oauthError(w, "server_error", "", 500)
+			return
+		}
+	}
+
+	w.WriteHeader(200)
+}
+
+// one scope on the consent page
+type consentScope struct {
+	Name        string
+	Description string
+}
+
+// everything the consent page shows, and the request it posts back in hidden fields
+type consentPage struct {
+	ClientName    string
+	ClientID      string
+	RedirectURI   string
+	Scope         string
+	Scopes        []consentScope
+	State         string
+	CodeChallenge string
+	Email         string
+	Error         string
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Authorize {{.ClientName}} - Chirpy</title>
+<style>
+body { font-family: sans-serif; max-width: 28rem; margin: 3rem auto; padding: 0 1rem; }
+label, input, button { display: block; width: 100%; box-sizing: border-box; }
+input { margin: 0.25rem 0 1rem; padding: 0.5rem; }
+button { margin-top: 0.5rem; padding: 0.6rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>Authorize {{.ClientName}}</h1>
+<p><strong>{{.ClientName}}</strong> wants to:</p>
+<ul>
+{{range .Scopes}}<li>{{.Description}} <small>({{.Name}})</small></li>
+{{end}}</ul>
+<p>You'll be sent back to {{.RedirectURI}}</p>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="/oauth/authorize">
+<input type="hidden" name="response_type" value="code">
+<input type="hidden" name="client_id" value="{{.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.RedirectURI}}">
+<input type="hidden" name="scope" value="{{.Scope}}">
+<input type="hidden" name="state" value="{{.State}}">
+<input type="hidden" name="code_challenge" value="{{.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="S256">
+<label for="email">Email</label>
+<input id="email" name="email" type="email" value="{{.Email}}" autocomplete="username" required>
+<label for="password">Password</label>
+<input id="password" name="password" type="password" autocomplete="current-password" required>
+<label for="code">Two-factor code (if enabled)</label>
+<input id="code" name="code" autocomplete="one-time-code">
+<button type="submit" name="decision" value="approve">Allow</button>
+<button type="submit" name="decision" value="deny" formnovalidate>Deny</button>
+</form>
+</body>
+</html>
+`))
+
+var authorizeErrorTemplate = template.Must(template.New("authorize-error").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Authorization failed - Chirpy</title>
+</head>
+<body>
+<h1>Authorization failed</h1>
+<p>{{.}}</p>
+</body>
+</html>
+`))
+
+func renderConsent(w http.ResponseWriter, req authorizeRequest, email, message string, statusCode int) {
+	page := consentPage{
+		ClientName:    req.client.Name,
+		ClientID:      req.client.ID,
+		RedirectURI:   req.redirectURI,
+		Scope:         req.scope,
+		State:         req.state,
+		CodeChallenge: req.codeChallenge,
+		Email:         email,
+		Error:         message,
+	}
+	for _, scope := range strings.Fields(req.scope) {
+		page.Scopes = append(page.Scopes, consentScope{Name: scope, Description: scopeDescriptions[scope]})
+	}
+
+	setPageHeaders(w)
+	w.WriteHeader(statusCode)
+	err := consentTemplate.Execute(w, page)
+	if err != nil {
+		log.Printf("Error rendering consent page: %s", err)
+	}
+}
+
+func renderAuthorizeError(w http.ResponseWriter, message string, statusCode int) {
+	setPageHeaders(w)
+	w.WriteHeader(statusCode)
+	err := authorizeErrorTemplate.Execute(w, message)
+	if err != nil {
+		log.Printf("Error rendering authorization error page: %s", err)
+	}
+}
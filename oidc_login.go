@@ -0,0 +1,322 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/peethree/chirpy/internal/auth"
+	"github.com/peethree/chirpy/internal/database"
+	"github.com/peethree/chirpy/internal/oidc"
+)
+
+const (
+	// how long the user has to sign in at the provider
+	oidcLoginTTL = 10 * time.Minute
+	// holds the state of the sign-in in the browser that started it
+	oidcStateCookie  = "chirpy_oidc_state"
+	oidcCallbackPath = "/api/oidc/callback"
+)
+
+var (
+	errNoVerifiedEmail   = errors.New("provider didn't share a verified email address")
+	errUnverifiedAccount = errors.New("account with the same email address isn't verified")
+)
+
+// the page the callback answers with, result is the same as POST api/login answers with
+var oidcLoginTemplate = template.Must(template.New("oidc-login").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Logging in - Chirpy</title>
+<style>
+body { font-family: sans-serif; max-width: 28rem; margin: 3rem auto; padding: 0 1rem; }
+label, input, button { display: block; width: 100%; box-sizing: border-box; }
+input { margin: 0.25rem 0 1rem; padding: 0.5rem; }
+button { padding: 0.6rem; }
+</style>
+</head>
+<body>
+<h1>Logging in to Chirpy</h1>
+<p id="message" role="status">One moment...</p>
+<form id="mfa" hidden>
+<label for="code">Two-factor code</label>
+<input id="code" name="code" autocomplete="one-time-code" required>
+<button type="submit">Log in</button>
+</form>
+<script nonce="{{.Nonce}}">
+const result = {{.Data}};
+// keep the code and state out of the history
+history.replaceState(null, "", location.pathname);
+
+const message = document.getElementById("message");
+const mfa = document.getElementById("mfa");
+let mfaToken = "";
+
+function finish(body) {
+  if (body.mfa_required) {
+    mfaToken = body.mfa_token;
+    mfa.hidden = false;
+    message.textContent = "Enter the code from your authenticator app, or a recovery code.";
+    return;
+  }
+  localStorage.setItem("chirpy_token", body.token);
+  localStorage.setItem("chirpy_refresh_token", body.refresh_token);
+  location.replace("/app/");
+}
+
+mfa.addEventListener("submit", async (event) => {
+  event.preventDefault();
+  const response = await fetch("/api/login/mfa", {
+    method: "POST",
+    headers: {"Content-Type": "application/json"},
+    body: JSON.stringify({mfa_token: mfaToken, code: mfa.code.value}),
+  });
+  if (!response.ok) {
+    message.textContent = await response.text();
+    return;
+  }
+  finish(await response.json());
+});
+
+finish(result);
+</script>
+</body>
+</html>
+`))
+
+// the OpenID Connect provider from the env, nil when OIDC_ISSUER isn't set
+func oidcProviderFromEnv(publicURL string) (*oidc.Provider, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+
+	redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = publicURL + oidcCallbackPath
+	}
+
+	return oidc.NewProvider(oidc.Config{
+		Issuer:       issuer,
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"email", "profile"},
+		HTTPClient:   &http.Client{Timeout: 10 * time.Second},
+	})
+}
+
+// sends the browser to the provider to sign in
+func (cfg *apiConfig) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if cfg.oidc == nil {
+		http.Error(w, "Single sign-on isn't set up", 404)
+		return
+	}
+
+	// state ties the callback to this browser, nonce ties the ID token to this sign-in,
+	// the verifier ties the code to chirpy (PKCE)
+	state, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error making oidc state: %s", err)
+		http.Error(w, "Unable to start sign-in", 500)
+		return
+	}
+	nonce, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error making oidc nonce: %s", err)
+		http.Error(w, "Unable to start sign-in", 500)
+		return
+	}
+	verifier, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error making code verifier: %s", err)
+		http.Error(w, "Unable to start sign-in", 500)
+		return
+	}
+
+	authURL, err := cfg.oidc.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("Error reaching the oidc provider: %s", err)
+		http.Error(w, "Unable to reach the sign-in provider", http.StatusBadGateway)
+		return
+	}
+
+	err = cfg.db.DeleteExpiredOIDCLogins(r.Context())
+	if err != nil {
+		log.Printf("Error deleting expired oidc logins: %s", err)
+	}
+
+	err = cfg.db.CreateOIDCLogin(r.Context(), database.CreateOIDCLoginParams{
+		StateHash:    auth.HashRefreshToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		TtlSeconds:   oidcLoginTTL.Seconds(),
+	})
+	if err != nil {
+		log.Printf("Error storing oidc login: %s", err)
+		http.Error(w, "Unable to start sign-in", 500)
+		return
+	}
+
+	// Lax, the provider sends the browser back with a top-level GET
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     oidcCallbackPath,
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(cfg.publicURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// where the provider sends the browser back to, logs the user in like POST api/login
+func (cfg *apiConfig) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if cfg.oidc == nil {
+		http.Error(w, "Single sign-on isn't set up", 404)
+		return
+	}
+
+	// the cookie is only good for one try
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: oidcCallbackPath, MaxAge: -1})
+
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		http.Error(w, "Sign-in failed at the provider: "+query.Get("error"), http.StatusUnauthorized)
+		return
+	}
+
+	// a callback this browser didn't start could log it into someone else's account
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		http.Error(w, "Sign-in wasn't started in this browser", 400)
+		return
+	}
+
+	login, err := cfg.db.UseOIDCLogin(r.Context(), auth.HashRefreshToken(state))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Sign-in expired or was already used, start again", 400)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading oidc login: %s", err)
+		http.Error(w, "Unable to sign in", 500)
+		return
+	}
+
+	claims, err := cfg.oidc.Exchange(r.Context(), query.Get("code"), login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Printf("Error verifying oidc sign-in: %s", err)
+		http.Error(w, "Unable to verify the sign-in", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := cfg.oidcUser(r, claims)
+	if errors.Is(err, errNoVerifiedEmail) {
+		http.Error(w, "The sign-in provider didn't share a verified email address", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, errUnverifiedAccount) {
+		http.Error(w, "An account with this email address exists but isn't verified, verify it and sign in again", http.StatusConflict)
+		return
+	}
+	if err != nil && isUniqueViolation(err) {
+		http.Error(w, "Email address is in use already", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error finding oidc user: %s", err)
+		http.Error(w, "Unable to sign in", 500)
+		return
+	}
+
+	// the provider counts as the password, two-factor authentication still applies
+	var result interface{}
+	if user.TotpEnabledAt.Valid {
+		result, err = cfg.makeMFAChallenge(user)
+	} else {
+		result, err = cfg.loginResponse(r, user)
+	}
+	if err != nil {
+		log.Printf("Error finishing oidc sign-in: %s", err)
+		http.Error(w, "Unable to make a token", 500)
+		return
+	}
+
+	// the browser opened this url itself, so the tokens go to the app through an uncached page
+	// instead of as JSON it would keep and show
+	renderScriptPage(w, oidcLoginTemplate, result)
+}
+
+// the user behind a provider account: the one linked to it, else the one with the same verified email address,
+// else a new user without a password
+func (cfg *apiConfig) oidcUser(r *http.Request, claims oidc.Claims) (database.User, error) {
+	issuer := cfg.oidc.Issuer()
+	email := sql.NullString{String: claims.Email, Valid: claims.Email != "" && bool(claims.EmailVerified)}
+
+	user, err := cfg.db.FindUserByIdentity(r.Context(), database.FindUserByIdentityParams{
+		Issuer:  issuer,
+		Subject: claims.Subject,
+	})
+	if err == nil {
+		err = cfg.db.TouchUserIdentity(r.Context(), database.TouchUserIdentityParams{
+			Email:   email,
+			Issuer:  issuer,
+			Subject: claims.Subject,
+		})
+		if err != nil {
+			log.Printf("Error updating identity: %s", err)
+		}
+		return user, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+
+	// the email address is the only way to match a new provider account to a user
+	if !email.Valid || !validEmail(email.String) {
+		return database.User{}, errNoVerifiedEmail
+	}
+
+	user, err = cfg.db.Login(r.Context(), email.String)
+	if errors.Is(err, sql.ErrNoRows) {
+		return cfg.db.CreateUserWithIdentity(r.Context(), database.CreateUserWithIdentityParams{
+			Email:    email.String,
+			Username: defaultUsername(),
+			Issuer:   issuer,
+			Subject:  claims.Subject,
+		})
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+
+	// anyone can sign up with an address they don't own, linking to such an account
+	// would hand the provider's user an account someone else knows the password of
+	if !user.EmailVerifiedAt.Valid {
+		return database.User{}, errUnverifiedAccount
+	}
+
+	err = cfg.db.CreateUserIdentity(r.Context(), database.CreateUserIdentityParams{
+		UserID:  user.ID,
+		Issuer:  issuer,
+		Subject: claims.Subject,
+		Email:   email,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	return user, nil
+}
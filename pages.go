@@ -0,0 +1,42 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/peethree/chirpy/internal/auth"
+)
+
+// headers for the html pages chirpy serves (OAuth consent, password reset, magic login, single sign-on):
+// they hold passwords and tokens, so they must not be framed, cached or leak their url in a Referer
+func setPageHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+}
+
+// what a script page's template gets: the script's nonce and data for the page, if any
+type scriptPage struct {
+	Nonce string
+	Data  interface{}
+}
+
+// renders a page that talks to the api with its inline script, the nonce lets only that script run
+func renderScriptPage(w http.ResponseWriter, page *template.Template, data interface{}) {
+	nonce, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error making script nonce: %s", err)
+		http.Error(w, "Unable to load page", 500)
+		return
+	}
+
+	setPageHeaders(w)
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; script-src 'nonce-"+nonce+"'; connect-src 'self'; frame-ancestors 'none'")
+	err = page.Execute(w, scriptPage{Nonce: nonce, Data: data})
+	if err != nil {
+		log.Printf("Error rendering %s page: %s", page.Name(), err)
+	}
+}
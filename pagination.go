@@ -0,0 +1,122 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// page size used when no ?limit= is given, and the most a client may ask for
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+// position in a list ordered by (created_at, id), handed to clients as an opaque string
+// search results are ordered by rank first, so their cursors carry the rank as well
+type pageCursor struct {
+	Rank      *float32  `json:"r,omitempty"`
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+}
+
+// limit and optional cursor parsed from the query string
+type pageParams struct {
+	Limit  int32
+	Cursor *pageCursor
+}
+
+func encodeCursor(c pageCursor) string {
+	dat, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(dat)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var c pageCursor
+
+	dat, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, errors.New("malformed cursor")
+	}
+
+	if err := json.Unmarshal(dat, &c); err != nil || c.ID == uuid.Nil {
+		return c, errors.New("malformed cursor")
+	}
+
+	return c, nil
+}
+
+// reads ?limit= and ?cursor=, falling back to the default page size
+func parsePageParams(query url.Values) (pageParams, error) {
+	params := pageParams{Limit: defaultPageLimit}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return params, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		params.Limit = int32(n)
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		c, err := decodeCursor(cursor)
+		if err != nil {
+			return params, err
+		}
+		params.Cursor = &c
+	}
+
+	return params, nil
+}
+
+// nullable query arguments for the keyset comparison, both NULL on the first page
+func (p pageParams) cursorArgs() (sql.NullTime, uuid.NullUUID) {
+	if p.Cursor == nil {
+		return sql.NullTime{}, uuid.NullUUID{}
+	}
+	return sql.NullTime{Time: p.Cursor.CreatedAt, Valid: true}, uuid.NullUUID{UUID: p.Cursor.ID, Valid: true}
+}
+
+// nullable rank for cursors of ranked (search) results
+func (p pageParams) rankArg() sql.NullFloat64 {
+	if p.Cursor == nil || p.Cursor.Rank == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: float64(*p.Cursor.Rank), Valid: true}
+}
+
+// queries fetch limit+1 rows, the extra row only tells us whether another page exists
+func (p pageParams) fetchLimit() int32 {
+	return p.Limit + 1
+}
+
+// trims the look-ahead row and returns the cursor for the following page, if there is one
+func paginate[T any](items []T, limit int32, key func(T) pageCursor) ([]T, *pageCursor) {
+	if int32(len(items)) <= limit {
+		return items, nil
+	}
+	items = items[:limit]
+	next := key(items[len(items)-1])
+	return items, &next
+}
+
+// advertises the next page as a Link header, keeping every other query parameter as is
+func setNextPageLink(w http.ResponseWriter, r *http.Request, next *pageCursor) {
+	if next == nil {
+		return
+	}
+
+	query := r.URL.Query()
+	query.Set("cursor", encodeCursor(*next))
+
+	nextURL := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", nextURL.String()))
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/peethree/chirpy/internal/auth"
+)
+
+// struct for responding to a password the policy rejected, error is one of the auth.Password* codes
+type responsePasswordError struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	// the minimum or maximum length, for the length codes
+	Limit int `json:"limit,omitempty"`
+}
+
+// checks a new password against the policy, emails are the user's current and requested addresses.
+// responds with 400 and returns false when the password is rejected
+func (cfg *apiConfig) acceptablePassword(w http.ResponseWriter, password string, emails ...string) bool {
+	err := cfg.passwordPolicy.Check(password, emails...)
+	if err == nil {
+		return true
+	}
+
+	var policyErr *auth.PasswordError
+	if !errors.As(err, &policyErr) {
+		log.Printf("Error checking password policy: %s", err)
+		http.Error(w, "Unable to check password", 500)
+		return false
+	}
+
+	encodeJSON(w, responsePasswordError{
+		Error:   policyErr.Code,
+		Message: policyErr.Message,
+		Limit:   policyErr.Limit,
+	}, 400)
+	return false
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/peethree/chirpy/internal/auth"
+	"github.com/peethree/chirpy/internal/database"
+	"github.com/peethree/chirpy/internal/mailer"
+)
+
+// reset links stop working after this long
+const passwordResetTTL = time.Hour
+
+// struct for requesting a reset email on POST api/password-reset
+type requestPasswordReset struct {
+	Email string `json:"email"`
+}
+
+// struct for setting the new password on POST api/password-reset/confirm
+type confirmPasswordReset struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// the page the reset email links to, it sends the token from the link and the new password to POST api/password-reset/confirm
+var resetPasswordTemplate = template.Must(template.New("reset-password").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Reset your password - Chirpy</title>
+<style>
+body { font-family: sans-serif; max-width: 28rem; margin: 3rem auto; padding: 0 1rem; }
+label, input, button { display: block; width: 100%; box-sizing: border-box; }
+input { margin: 0.25rem 0 1rem; padding: 0.5rem; }
+button { padding: 0.6rem; }
+</style>
+</head>
+<body>
+<h1>Reset your password</h1>
+<form id="reset">
+<label for="password">New password</label>
+<input id="password" name="password" type="password" autocomplete="new-password" required>
+<button type="submit">Set password</button>
+</form>
+<p id="message" role="status"></p>
+<script nonce="{{.Nonce}}">
+const token = new URLSearchParams(location.search).get("token");
+// keep the token out of the history and of anything the page links to
+history.replaceState(null, "", location.pathname);
+
+const form = document.getElementById("reset");
+const message = document.getElementById("message");
+if (!token) {
+  form.hidden = true;
+  message.textContent = "This link is incomplete, open the one from the email again.";
+}
+
+form.addEventListener("submit", async (event) => {
+  event.preventDefault();
+  message.textContent = "";
+  const response = await fetch("/api/password-reset/confirm", {
+    method: "POST",
+    headers: {"Content-Type": "application/json"},
+    body: JSON.stringify({token: token, password: form.password.value}),
+  });
+  if (response.ok) {
+    form.hidden = true;
+    message.textContent = "Your password is changed, log in with it everywhere again.";
+    return;
+  }
+  // rejected passwords come back as json, the link keeps working for another try
+  const body = await response.text();
+  try {
+    message.textContent = JSON.parse(body).message;
+  } catch {
+    message.textContent = body;
+  }
+});
+</script>
+</body>
+</html>
+`))
+
+// serves the page the reset email links to
+func resetPasswordPageHandler(w http.ResponseWriter, r *http.Request) {
+	renderScriptPage(w, resetPasswordTemplate, nil)
+}
+
+// emails a reset link if the address belongs to a user
+// always answers 202, so the endpoint can't be used to find out who has an account
+func (cfg *apiConfig) passwordResetHandler(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	params := requestPasswordReset{}
+	err := decoder.Decode(&params)
+	if err != nil || params.Email == "" {
+		http.Error(w, "Invalid Json", 400)
+		return
+	}
+
+	user, err := cfg.db.FindEmail(r.Context(), params.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if err != nil {
+		log.Printf("Error finding user: %s", err)
+		http.Error(w, "Unable to reset password", 500)
+		return
+	}
+
+	// same shape as refresh tokens: 32 random bytes, only the digest is stored
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error making reset token: %s", err)
+		http.Error(w, "Unable to reset password", 500)
+		return
+	}
+
+	err = cfg.db.CreatePasswordResetToken(r.Context(), database.CreatePasswordResetTokenParams{
+		TokenHash:  auth.HashRefreshToken(token),
+		UserID:     user.ID,
+		TtlSeconds: passwordResetTTL.Seconds(),
+	})
+	if err != nil {
+		log.Printf("Error storing reset token: %s", err)
+		http.Error(w, "Unable to reset password", 500)
+		return
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", cfg.publicURL, url.QueryEscape(token))
+	cfg.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your Chirpy account.\n\n"+
+			"Set a new password here, the link works once and expires in %s:\n%s\n\n"+
+			"If that wasn't you, ignore this email, your password stays the same.\n", passwordResetTTL, link),
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sets a new password with the token from the reset email, and logs the user out everywhere
+func (cfg *apiConfig) confirmPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	params := confirmPasswordReset{}
+	err := decoder.Decode(&params)
+	if err != nil || params.Token == "" {
+		http.Error(w, "Invalid Json", 400)
+		return
+	}
+
+	// the token isn't used up yet, so a rejected password can be retried with the same link
+	email, err := cfg.db.FindPasswordResetEmail(r.Context(), auth.HashRefreshToken(params.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Reset link is invalid or expired", 400)
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up reset token: %s", err)
+		http.Error(w, "Unable to reset password", 500)
+		return
+	}
+
+	// same rules as signing up
+	if !cfg.acceptablePassword(w, params.Password, email) {
+		return
+	}
+
+	hashedPassword, err := cfg.passwords.Hash(params.Password)
+	if err != nil {
+		log.Printf("Error hashing password: %s", err)
+		http.Error(w, "Unable to hash password", 500)
+		return
+	}
+
+	// the token is used up here, even if something below fails
+	userID, err := cfg.db.UsePasswordResetToken(r.Context(), auth.HashRefreshToken(params.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Reset link is invalid or expired", 400)
+		return
+	}
+	if err != nil {
+		log.Printf("Error using reset token: %s", err)
+		http.Error(w, "Unable to reset password", 500)
+		return
+	}
+
+	_, err = cfg.db.UpdateUser(r.Context(), database.UpdateUserParams{
+		HashedPassword: sql.NullString{String: hashedPassword, Valid: true},
+		ID:             userID,
+	})
+	if err != nil {
+		log.Printf("Error updating password: %s", err)
+		http.Error(w, "Unable to reset password", 500)
+		return
+	}
+
+	// whoever knew the old password shouldn't stay logged in or keep tokens they made, and older reset emails are void
+	err = cfg.db.RevokeAllSessions(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error revoking sessions: %s", err)
+	}
+	err = cfg.db.RevokeAllPersonalAccessTokens(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error revoking personal access tokens: %s", err)
+	}
+	err = cfg.db.ExpirePasswordResetTokens(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error expiring reset tokens: %s", err)
+	}
+
+	w.WriteHeader(204)
+}
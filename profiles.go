@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/peethree/chirpy/internal/database"
+)
+
+// limits for the free-form profile fields
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxAvatarURLLength   = 2048
+)
+
+// struct for updating the user on PUT api/users, fields left out (null) stay as they are
+type updateUserParams struct {
+	Email        *string `json:"email"`
+	Password     *string `json:"password"`
+	Username     *string `json:"username"`
+	Display_name *string `json:"display_name"`
+	Bio          *string `json:"bio"`
+	Avatar_url   *string `json:"avatar_url"`
+}
+
+// struct for responding to GET api/users/{idOrUsername}, public so no email address
+type responseProfile struct {
+	Id              uuid.UUID `json:"id"`
+	Created_at      time.Time `json:"created_at"`
+	Username        string    `json:"username"`
+	Display_name    string    `json:"display_name"`
+	Bio             string    `json:"bio"`
+	Avatar_url      string    `json:"avatar_url"`
+	Is_chirpy_red   bool      `json:"is_chirpy_red"`
+	Follower_count  int64     `json:"follower_count"`
+	Following_count int64     `json:"following_count"`
+	Chirp_count     int64     `json:"chirp_count"`
+}
+
+// handle for users who signed up without picking one, same shape as the migration backfill
+func defaultUsername() string {
+	return "user_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:12]
+}
+
+// NULL for fields that weren't sent, so the update keeps their current value
+func nullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
+}
+
+// checks the profile fields that were sent, an empty display name, bio or avatar clears it
+func (p updateUserParams) validateProfile() error {
+	if p.Username != nil && !validUsername(*p.Username) {
+		return errors.New("username must be 3 to 30 letters, digits or underscores")
+	}
+
+	if p.Display_name != nil && utf8.RuneCountInString(*p.Display_name) > maxDisplayNameLength {
+		return fmt.Errorf("display name can't be longer than %d characters", maxDisplayNameLength)
+	}
+
+	if p.Bio != nil && utf8.RuneCountInString(*p.Bio) > maxBioLength {
+		return fmt.Errorf("bio can't be longer than %d characters", maxBioLength)
+	}
+
+	if p.Avatar_url != nil && *p.Avatar_url != "" {
+		if len(*p.Avatar_url) > maxAvatarURLLength {
+			return fmt.Errorf("avatar url can't be longer than %d characters", maxAvatarURLLength)
+		}
+		avatar, err := url.Parse(*p.Avatar_url)
+		if err != nil || (avatar.Scheme != "http" && avatar.Scheme != "https") || avatar.Host == "" {
+			return errors.New("avatar url must be an absolute http(s) url")
+		}
+	}
+
+	return nil
+}
+
+// public profile of a user, looked up by id or username
+func (cfg *apiConfig) profileHandler(w http.ResponseWriter, r *http.Request) {
+	idOrUsername := r.PathValue("idOrUsername")
+
+	// usernames can't contain dashes, so anything that parses as a uuid is an id
+	params := database.LoadUserProfileParams{}
+	if userID, err := uuid.Parse(idOrUsername); err == nil {
+		params.ID = uuid.NullUUID{UUID: userID, Valid: true}
+	} else if validUsername(idOrUsername) {
+		params.Username = sql.NullString{String: idOrUsername, Valid: true}
+	} else {
+		http.Error(w, "Unable to find user", 404)
+		return
+	}
+
+	profile, err := cfg.db.LoadUserProfile(r.Context(), params)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Unable to find user", 404)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading profile: %s", err)
+		http.Error(w, "Unable to load profile", 500)
+		return
+	}
+
+	response := responseProfile{
+		Id:              profile.User.ID,
+		Created_at:      profile.User.CreatedAt,
+		Username:        profile.User.Username,
+		Display_name:    profile.User.DisplayName,
+		Bio:             profile.User.Bio,
+		Avatar_url:      profile.User.AvatarUrl,
+		Is_chirpy_red:   profile.User.IsChirpyRed,
+		Follower_count:  profile.FollowerCount,
+		Following_count: profile.FollowingCount,
+		Chirp_count:     profile.ChirpCount,
+	}
+
+	encodeJSON(w, response, 200)
+}
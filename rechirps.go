@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/peethree/chirpy/internal/database"
+)
+
+// values of chirps.repost_kind
+const (
+	repostKindRechirp = "rechirp"
+	repostKindQuote   = "quote"
+)
+
+// body of a tombstone, shown in place of a deleted original
+const unavailableChirpMessage = "chirp unavailable"
+
+// the chirp a rechirp or quote points at
+// once the original is deleted, only Unavailable and Message are set
+type responseOriginal struct {
+	*responseChirp
+	Unavailable bool   `json:"unavailable,omitempty"`
+	Message     string `json:"message,omitempty"`
+}
+
+// pointers into a slice of responses, so helpers can fill them in place
+func chirpRefs(chirps []responseChirp) []*responseChirp {
+	refs := make([]*responseChirp, len(chirps))
+	for i := range chirps {
+		refs[i] = &chirps[i]
+	}
+	return refs
+}
+
+// fills in Original for every rechirp and quote, with one query for all of them
+// originals are embedded one level deep, an original that is itself a quote doesn't get its own original
+func (cfg *apiConfig) embedOriginals(ctx context.Context, chirps []*responseChirp, viewer uuid.NullUUID) error {
+	var ids []uuid.UUID
+	for _, chirp := range chirps {
+		if chirp.repostOf.Valid {
+			ids = append(ids, chirp.repostOf.UUID)
+		}
+	}
+
+	originals := map[uuid.UUID]responseChirp{}
+	if len(ids) > 0 {
+		rows, err := cfg.db.LoadChirpsByIDs(ctx, database.LoadChirpsByIDsParams{
+			ViewerID: viewer,
+			Ids:      ids,
+		})
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			originals[row.ID] = likedChirpResponse(loadedChirp(row), viewer)
+		}
+	}
+
+	for _, chirp := range chirps {
+		if chirp.Repost_kind == "" {
+			continue
+		}
+		original, ok := originals[chirp.repostOf.UUID]
+		if !chirp.repostOf.Valid || !ok {
+			// the original was deleted
+			chirp.Original = &responseOriginal{Unavailable: true, Message: unavailableChirpMessage}
+			continue
+		}
+		chirp.Original = &responseOriginal{responseChirp: &original}
+	}
+
+	return nil
+}
+
+// the chirp that actually gets reposted: reposting a plain rechirp reposts its original instead
+func (cfg *apiConfig) repostTarget(ctx context.Context, chirpID uuid.UUID) (database.Chirp, error) {
+	chirp, err := cfg.db.LoadChirpByID(ctx, chirpID)
+	if err != nil {
+		return chirp, err
+	}
+
+	if chirp.RepostKind.String != repostKindRechirp {
+		return chirp, nil
+	}
+
+	if !chirp.RepostOf.Valid {
+		return chirp, errors.New("original chirp was deleted")
+	}
+
+	return cfg.db.LoadChirpByID(ctx, chirp.RepostOf.UUID)
+}
+
+// reposts a chirp without a comment, rechirping the same chirp twice returns the existing rechirp
+func (cfg *apiConfig) rechirpHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := cfg.authenticate(w, r, scopeChirpsWrite)
+	if !ok {
+		return
+	}
+	userID := c.userID
+
+	// posting may require a verified email address
+	allowed, err := cfg.mayPost(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error checking email verification: %s", err)
+		http.Error(w, "Unable to post", 500)
+		return
+	}
+	if !allowed {
+		http.Error(w, "Verify your email address before posting", http.StatusForbidden)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		http.Error(w, "Cannot find the chirp", 404)
+		return
+	}
+
+	original, err := cfg.repostTarget(r.Context(), chirpID)
+	if err != nil {
+		http.Error(w, "Cannot find the chirp", 404)
+		return
+	}
+
+	findParams := database.FindRechirpParams{
+		UserID:   userID,
+		RepostOf: uuid.NullUUID{UUID: original.ID, Valid: true},
+	}
+
+	statusCode := 200
+	rechirp, err := cfg.db.FindRechirp(r.Context(), findParams)
+	if errors.Is(err, sql.ErrNoRows) {
+		statusCode = 201
+		rechirp, err = cfg.db.CreateChirp(r.Context(), database.CreateChirpParams{
+			Body:       "",
+			UserID:     userID,
+			RepostOf:   findParams.RepostOf,
+			RepostKind: sql.NullString{String: repostKindRechirp, Valid: true},
+		})
+		if err != nil && isUniqueViolation(err) {
+			// lost a race against a concurrent rechirp, the unique index kept it to one
+			statusCode = 200
+			rechirp, err = cfg.db.FindRechirp(r.Context(), findParams)
+		}
+	}
+	if err != nil {
+		log.Printf("Error rechirping: %s", err)
+		http.Error(w, "Unable to rechirp", 500)
+		return
+	}
+
+	viewer := uuid.NullUUID{UUID: userID, Valid: true}
+	response := chirpResponse(rechirp)
+	response.Liked_by_me = new(bool)
+	response.Valid = true
+	err = cfg.hydrateChirps(r.Context(), []*responseChirp{&response}, viewer)
+	if err != nil {
+		log.Printf("Error loading original chirp: %s", err)
+	}
+
+	encodeResponse(w, response, statusCode)
+}
+
+// removes the user's rechirp of a chirp, the chirp can be the rechirp itself like on POST
+// undoing deletes a chirp, so it takes the same scope as DELETE api/chirps/{chirpID}
+func (cfg *apiConfig) undoRechirpHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := cfg.authenticate(w, r, scopeChirpsDelete)
+	if !ok {
+		return
+	}
+	userID := c.userID
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		http.Error(w, "Cannot find the chirp", 404)
+		return
+	}
+
+	original, err := cfg.repostTarget(r.Context(), chirpID)
+	if err != nil {
+		http.Error(w, "Cannot find the chirp", 404)
+		return
+	}
+
+	deleted, err := cfg.db.DeleteRechirp(r.Context(), database.DeleteRechirpParams{
+		UserID:   userID,
+		RepostOf: uuid.NullUUID{UUID: original.ID, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Error undoing rechirp: %s", err)
+		http.Error(w, "Unable to undo rechirp", 500)
+		return
+	}
+	if deleted == 0 {
+		http.Error(w, "Cannot find the rechirp", 404)
+		return
+	}
+
+	w.WriteHeader(204)
+}
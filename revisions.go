@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/peethree/chirpy/internal/database"
+)
+
+// struct for responding to api/chirps/{chirpID}/revisions
+type responseRevision struct {
+	ID          uuid.UUID `json:"id"`
+	Body        string    `json:"body"`
+	Created_at  time.Time `json:"created_at"`
+	Replaced_at time.Time `json:"replaced_at"`
+}
+
+// lets the author replace the body of a chirp, the old body is kept as a revision
+func (cfg *apiConfig) editChirpHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := cfg.authenticate(w, r, scopeChirpsWrite)
+	if !ok {
+		return
+	}
+	tokenUser := c.userID
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		http.Error(w, "Cannot find the chirp", 404)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := Chirp{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		http.Error(w, "Invalid Json", 400)
+		return
+	}
+
+	chirp, err := cfg.db.LoadChirpByID(r.Context(), chirpID)
+	if err != nil {
+		http.Error(w, "Cannot find the chirp", 404)
+		return
+	}
+
+	// same ownership check as deleting
+	if chirp.UserID != tokenUser {
+		http.Error(w, "Cannot edit others' chirps", http.StatusForbidden)
+		return
+	}
+
+	// a plain rechirp has no body of its own
+	if chirp.RepostKind.String == repostKindRechirp {
+		http.Error(w, "Rechirps can't be edited", 400)
+		return
+	}
+
+	// same rules as a new chirp, a quote needs something to say about the chirp it quotes
+	if chirp.RepostKind.String == repostKindQuote && strings.TrimSpace(params.Body) == "" {
+		http.Error(w, "A quote needs a body", 400)
+		return
+	}
+	if len(params.Body) > maxChirpLength {
+		response := responseChirp{
+			Error: "Chirp is too long",
+			Valid: false,
+		}
+		encodeResponse(w, response, 400)
+		return
+	}
+
+	removedProfanity := replaceProfanity(params.Body)
+
+	// nothing changed, don't store a revision identical to the current body
+	if removedProfanity != chirp.Body {
+		edited, err := cfg.db.EditChirp(r.Context(), database.EditChirpParams{
+			ID:   chirp.ID,
+			Body: removedProfanity,
+		})
+		if err != nil {
+			log.Printf("Error editing chirp: %s", err)
+			http.Error(w, "Unable to edit chirp", 500)
+			return
+		}
+
+		// the edit may have added or removed #tags and @mentions
+		err = cfg.indexChirp(r.Context(), edited)
+		if err != nil {
+			log.Printf("Error indexing chirp: %s", err)
+		}
+	}
+
+	// reload to include the like count
+	viewer := uuid.NullUUID{UUID: tokenUser, Valid: true}
+	edited, err := cfg.db.LoadChirpDetail(r.Context(), database.LoadChirpDetailParams{
+		ViewerID: viewer,
+		ID:       chirp.ID,
+	})
+	if err != nil {
+		log.Printf("Error loading edited chirp: %s", err)
+		http.Error(w, "Unable to load edited chirp", 500)
+		return
+	}
+
+	response := likedChirpResponse(loadedChirp(edited), viewer)
+	response.Valid = true
+	err = cfg.hydrateChirps(r.Context(), []*responseChirp{&response}, viewer)
+	if err != nil {
+		log.Printf("Error loading quoted chirp: %s", err)
+	}
+	encodeResponse(w, response, 200)
+}
+
+// lists the previous bodies of a chirp, most recently replaced first
+func (cfg *apiConfig) chirpRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		http.Error(w, "Can't find this chirp", 404)
+		return
+	}
+
+	// 404 for unknown chirps rather than an empty history
+	_, err = cfg.db.LoadChirpByID(r.Context(), chirpID)
+	if err != nil {
+		http.Error(w, "Can't find this chirp", 404)
+		return
+	}
+
+	revisions, err := cfg.db.LoadChirpRevisions(r.Context(), chirpID)
+	if err != nil {
+		log.Printf("Error loading revisions: %s", err)
+		http.Error(w, "Can't load revisions", 500)
+		return
+	}
+
+	response := []responseRevision{}
+	for _, revision := range revisions {
+		response = append(response, responseRevision{
+			ID:          revision.ID,
+			Body:        revision.Body,
+			Created_at:  revision.CreatedAt,
+			Replaced_at: revision.ReplacedAt,
+		})
+	}
+
+	encodeJSON(w, response, 200)
+}
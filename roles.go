@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/peethree/chirpy/internal/database"
+)
+
+// what a user may do besides using their own account, every role can do what the ones before it can
+const (
+	roleUser = "user"
+	// deletes any chirp
+	roleModerator = "moderator"
+	// uses /admin/* and changes roles
+	roleAdmin = "admin"
+)
+
+var roleRanks = map[string]int{
+	roleUser:      0,
+	roleModerator: 1,
+	roleAdmin:     2,
+}
+
+// struct for changing a role on PUT admin/users/{userID}/role
+type requestRole struct {
+	Role string `json:"role"`
+}
+
+// request context key for the caller middlewareRequireRole let through
+type callerKey struct{}
+
+// the caller middlewareRequireRole let through, false for handlers it doesn't wrap
+func requestCaller(r *http.Request) (caller, bool) {
+	c, ok := r.Context().Value(callerKey{}).(caller)
+	return c, ok
+}
+
+// whether the caller has role or a higher one, personal access tokens and OAuth clients never have more than user
+func (c caller) hasRole(role string) bool {
+	if c.scoped {
+		return role == roleUser
+	}
+	return roleRanks[c.role] >= roleRanks[role]
+}
+
+// the role claim for an access token, regular users carry none
+func roleClaim(role string) string {
+	if role == roleUser {
+		return ""
+	}
+	return role
+}
+
+// lets only callers with role (or a higher one) through to next: 401 without a login session's access token, 403 without the role
+// next finds the caller with requestCaller
+// the role comes from the access token, so a changed role applies once the user refreshes (within accessTokenTTL)
+func (cfg *apiConfig) middlewareRequireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, ok := cfg.authenticate(w, r, scopeSessionOnly)
+		if !ok {
+			return
+		}
+
+		if !c.hasRole(role) {
+			http.Error(w, "No permission for this endpoint", http.StatusForbidden)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, c)))
+	}
+}
+
+// gives a user another role, behind middlewareRequireRole(roleAdmin)
+func (cfg *apiConfig) updateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := requestCaller(r)
+	if !ok {
+		log.Printf("Error: updateRoleHandler is served without middlewareRequireRole")
+		http.Error(w, "Unable to update role", 500)
+		return
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		http.Error(w, "Invalid user id", 400)
+		return
+	}
+
+	// so there's always an admin left to undo mistakes
+	if userID == c.userID {
+		http.Error(w, "Admins can't change their own role", http.StatusForbidden)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := requestRole{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		http.Error(w, "Invalid Json", 400)
+		return
+	}
+
+	if _, ok := roleRanks[params.Role]; !ok {
+		http.Error(w, "Role must be user, moderator or admin", 400)
+		return
+	}
+
+	user, err := cfg.db.UpdateUserRole(r.Context(), database.UpdateUserRoleParams{
+		Role: params.Role,
+		ID:   userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Unable to find the user", 404)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating role: %s", err)
+		http.Error(w, "Unable to update role", 500)
+		return
+	}
+
+	log.Printf("User %s changed the role of %s to %s", c.userID, user.ID, user.Role)
+
+	encodeJSON(w, userResponse(user), 200)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/peethree/chirpy/internal/database"
+)
+
+// longest search query we accept, anything above is most likely not typed by a person
+const maxSearchQueryLength = 256
+
+// full-text search over chirp bodies, best match first
+// q uses web search syntax: "quoted phrases", or, -excluded words
+func (cfg *apiConfig) searchChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	searchQuery := strings.TrimSpace(query.Get("q"))
+	if searchQuery == "" {
+		http.Error(w, "search query q is required", 400)
+		return
+	}
+	if len(searchQuery) > maxSearchQueryLength {
+		http.Error(w, "search query is too long", 400)
+		return
+	}
+
+	page, err := parsePageParams(query)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	// a cursor from the plain chirp list has no rank and can't be used to continue a search
+	if page.Cursor != nil && page.Cursor.Rank == nil {
+		http.Error(w, "malformed cursor", 400)
+		return
+	}
+
+	author := uuid.NullUUID{}
+	if queryAuthor := query.Get("author_id"); queryAuthor != "" {
+		authorID, err := uuid.Parse(queryAuthor)
+		if err != nil {
+			http.Error(w, "unable to parse query into uuid", 400)
+			return
+		}
+		author = uuid.NullUUID{UUID: authorID, Valid: true}
+	}
+
+	cursorCreatedAt, cursorID := page.cursorArgs()
+
+	viewer := cfg.optionalViewer(r)
+
+	results, err := cfg.db.SearchChirps(r.Context(), database.SearchChirpsParams{
+		Query:           searchQuery,
+		ViewerID:        viewer,
+		AuthorID:        author,
+		CursorRank:      page.rankArg(),
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		log.Printf("Error searching chirps: %s", err)
+		http.Error(w, "Can't search chirps", 500)
+		return
+	}
+
+	results, next := paginate(results, page.Limit, func(result database.SearchChirpsRow) pageCursor {
+		rank := result.Rank
+		return pageCursor{Rank: &rank, CreatedAt: result.CreatedAt, ID: result.ID}
+	})
+
+	response := []responseChirp{}
+	for _, result := range results {
+		response = append(response, likedChirpResponse(loadedChirp{
+			ID:         result.ID,
+			CreatedAt:  result.CreatedAt,
+			UpdatedAt:  result.UpdatedAt,
+			Body:       result.Body,
+			UserID:     result.UserID,
+			InReplyTo:  result.InReplyTo,
+			RepostOf:   result.RepostOf,
+			RepostKind: result.RepostKind,
+			LikeCount:  result.LikeCount,
+			LikedByMe:  result.LikedByMe,
+		}, viewer))
+	}
+
+	err = cfg.hydrateChirps(r.Context(), chirpRefs(response), viewer)
+	if err != nil {
+		log.Printf("Error loading original chirps: %s", err)
+		http.Error(w, "Can't search chirps", 500)
+		return
+	}
+
+	setNextPageLink(w, r, next)
+	encodeJSON(w, response, 200)
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/peethree/chirpy/internal/auth"
+	"github.com/peethree/chirpy/internal/database"
+)
+
+// access tokens are short lived, refresh tokens last refreshTokenTTL since their last rotation
+const accessTokenTTL = time.Hour
+
+// longer user agents get cut off before they're stored
+const maxUserAgentLength = 512
+
+// a refresh token that was already rotated or revoked got presented again
+var errRefreshTokenReused = errors.New("refresh token reused")
+
+// a refresh token that is unknown or expired
+var errRefreshTokenInvalid = errors.New("refresh token invalid")
+
+// struct for responding to GET api/sessions, one per login (token family)
+type responseSession struct {
+	Id           uuid.UUID  `json:"id"`
+	Created_at   time.Time  `json:"created_at"`
+	Last_used_at *time.Time `json:"last_used_at"`
+	Expires_at   time.Time  `json:"expires_at"`
+	User_agent   string     `json:"user_agent"`
+	Ip_address   string     `json:"ip_address"`
+	// set for apps authorized through OAuth, null for logins
+	Client_id   *string  `json:"client_id"`
+	Client_name *string  `json:"client_name"`
+	Scopes      []string `json:"scopes,omitempty"`
+}
+
+// struct for responding to a successful login
+type responseLogin struct {
+	User
+	Token         string `json:"token"`
+	Refresh_token string `json:"refresh_token"`
+}
+
+// the tokens handed out on login and on every refresh
+type session struct {
+	UserID uuid.UUID
+	// the token family, revoking it ends the session
+	FamilyID     uuid.UUID
+	AccessToken  string
+	RefreshToken string
+	// space separated, empty for logins
+	Scopes string
+}
+
+// starts a new token family, one per login, remembering the device it was made from
+func (cfg *apiConfig) startSession(r *http.Request, userID uuid.UUID) (session, error) {
+	return cfg.startTokenFamily(r, userID, sql.NullString{}, "")
+}
+
+// starts a new token family for an OAuth client, its tokens are limited to scopes
+func (cfg *apiConfig) startClientSession(r *http.Request, userID uuid.UUID, clientID, scopes string) (session, error) {
+	return cfg.startTokenFamily(r, userID, sql.NullString{String: clientID, Valid: true}, scopes)
+}
+
+func (cfg *apiConfig) startTokenFamily(r *http.Request, userID uuid.UUID, clientID sql.NullString, scopes string) (session, error) {
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return session{}, err
+	}
+
+	token, err := cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		TokenHash:  auth.HashRefreshToken(refreshToken),
+		UserID:     userID,
+		FamilyID:   uuid.New(),
+		TtlSeconds: cfg.refreshTokenTTL.Seconds(),
+		UserAgent:  sessionUserAgent(r),
+		IpAddress:  cfg.clientIP(r),
+		ClientID:   clientID,
+		Scopes:     scopes,
+	})
+	if err != nil {
+		return session{}, err
+	}
+
+	return cfg.sessionTokens(r.Context(), token, refreshToken)
+}
+
+// the last step of every way to log in: starts a session and hands out its tokens with the user
+func (cfg *apiConfig) completeLogin(w http.ResponseWriter, r *http.Request, user database.User) {
+	response, err := cfg.loginResponse(r, user)
+	if err != nil {
+		log.Printf("Error starting session: %s", err)
+		http.Error(w, "Unable to make a token", 500)
+		return
+	}
+
+	encodeJSON(w, response, 200)
+}
+
+// starts a session for user and returns its tokens with the user
+func (cfg *apiConfig) loginResponse(r *http.Request, user database.User) (responseLogin, error) {
+	// access token plus the first refresh token of a new token family
+	session, err := cfg.startSession(r, user.ID)
+	if err != nil {
+		return responseLogin{}, err
+	}
+
+	return responseLogin{
+		User:          userResponse(user),
+		Token:         session.AccessToken,
+		Refresh_token: session.RefreshToken,
+	}, nil
+}
+
+// swaps a refresh token for a new one in the same family, clientID is the OAuth client it was issued to (NULL for logins)
+// presenting a token that was already swapped means two parties hold it, so the whole family gets revoked
+func (cfg *apiConfig) rotateSession(ctx context.Context, presented string, clientID sql.NullString) (session, error) {
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return session{}, err
+	}
+
+	rotated, err := cfg.db.RotateRefreshToken(ctx, database.RotateRefreshTokenParams{
+		OldTokenHash: auth.HashRefreshToken(presented),
+		ClientID:     clientID,
+		NewTokenHash: auth.HashRefreshToken(refreshToken),
+		TtlSeconds:   cfg.refreshTokenTTL.Seconds(),
+	})
+	if err == nil {
+		return cfg.sessionTokens(ctx, rotated, refreshToken)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return session{}, err
+	}
+
+	// find out why the token couldn't be rotated
+	token, err := cfg.db.FindRefreshToken(ctx, auth.HashRefreshToken(presented))
+	if errors.Is(err, sql.ErrNoRows) {
+		return session{}, errRefreshTokenInvalid
+	}
+	if err != nil {
+		return session{}, err
+	}
+
+	if !token.RevokedAt.Valid {
+		// still live, so it expired or belongs to another client
+		return session{}, errRefreshTokenInvalid
+	}
+
+	err = cfg.db.RevokeTokenFamily(ctx, token.FamilyID)
+	if err != nil {
+		return session{}, err
+	}
+	return session{}, errRefreshTokenReused
+}
+
+// the User-Agent header cut to maxUserAgentLength bytes, as valid UTF-8 since postgres rejects anything else
+func sessionUserAgent(r *http.Request) string {
+	userAgent := strings.ToValidUTF8(r.UserAgent(), "\uFFFD")
+	if len(userAgent) <= maxUserAgentLength {
+		return userAgent
+	}
+
+	// cut before the character that doesn't fit whole
+	end := maxUserAgentLength
+	for end > 0 && !utf8.RuneStart(userAgent[end]) {
+		end--
+	}
+	return userAgent[:end]
+}
+
+// address of the client, without the port
+// X-Forwarded-For is only believed from TRUSTED_PROXIES, anyone else could send it:
+// the client is the last address in it that isn't a trusted proxy
+func (cfg *apiConfig) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	remote, err := netip.ParseAddr(host)
+	if err != nil || !cfg.trustedProxy(remote) {
+		return host
+	}
+
+	// every proxy appends the address it got the request from
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		host = addr.Unmap().String()
+		if !cfg.trustedProxy(addr) {
+			break
+		}
+	}
+
+	return host
+}
+
+func (cfg *apiConfig) trustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, proxy := range cfg.trustedProxies {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// reads a comma separated list of addresses and CIDR ranges like "10.0.0.0/8, ::1"
+func parseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		if strings.Contains(field, "/") {
+			prefix, err := netip.ParsePrefix(field)
+			if err != nil {
+				return nil, err
+			}
+			proxies = append(proxies, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(field)
+		if err != nil {
+			return nil, err
+		}
+		addr = addr.Unmap()
+		proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	return proxies, nil
+}
+
+// the access token that goes with a refresh token, limited to the same scopes
+func (cfg *apiConfig) sessionTokens(ctx context.Context, token database.RefreshToken, refreshToken string) (session, error) {
+	var accessToken string
+	if token.ClientID.Valid {
+		var err error
+		accessToken, err = cfg.keys.MakeScopedJWT(token.UserID, token.ClientID.String, token.Scopes, accessTokenTTL)
+		if err != nil {
+			return session{}, err
+		}
+	} else {
+		// looked up on every refresh, so a changed role applies within accessTokenTTL
+		role, err := cfg.db.FindUserRole(ctx, token.UserID)
+		if err != nil {
+			return session{}, err
+		}
+		accessToken, err = cfg.keys.MakeRoleJWT(token.UserID, roleClaim(role), accessTokenTTL)
+		if err != nil {
+			return session{}, err
+		}
+	}
+
+	return session{
+		UserID:       token.UserID,
+		FamilyID:     token.FamilyID,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		Scopes:       token.Scopes,
+	}, nil
+}
+
+// trades a refresh token for a new access token and a new refresh token, the old refresh token stops working
+func (cfg *apiConfig) refreshHandler(w http.ResponseWriter, r *http.Request) {
+	refreshToken, err := auth.GetBearerToken(r.Header)
+	if err != nil || refreshToken == "" {
+		http.Error(w, "No refresh token found", http.StatusUnauthorized)
+		return
+	}
+
+	// refresh tokens of OAuth clients are refreshed at /oauth/token
+	session, err := cfg.rotateSession(r.Context(), refreshToken, sql.NullString{})
+	if errors.Is(err, errRefreshTokenReused) {
+		log.Printf("Refresh token reused, revoked its token family")
+		http.Error(w, "Refresh token was already used, log in again", http.StatusUnauthorized)
+		return
+	}
+	if errors.Is(err, errRefreshTokenInvalid) {
+		http.Error(w, "Refresh token is invalid or expired", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("Error rotating refresh token: %s", err)
+		http.Error(w, "Unable to refresh token", 500)
+		return
+	}
+
+	response := responseRefresh{
+		Token:         session.AccessToken,
+		Refresh_token: session.RefreshToken,
+	}
+
+	encodeJSON(w, response, 200)
+}
+
+// logs out: revokes the refresh token and every other token of the same login
+func (cfg *apiConfig) revokeHandler(w http.ResponseWriter, r *http.Request) {
+	// get the bearer token from authorization header
+	refreshToken, err := auth.GetBearerToken(r.Header)
+	if err != nil || refreshToken == "" {
+		http.Error(w, "No refresh token found", http.StatusUnauthorized)
+		return
+	}
+
+	// look for the token in the db, only its digest is stored
+	token, err := cfg.db.FindRefreshToken(r.Context(), auth.HashRefreshToken(refreshToken))
+	if err != nil {
+		http.Error(w, "No match with token in DB", http.StatusUnauthorized)
+		return
+	}
+
+	err = cfg.db.RevokeTokenFamily(r.Context(), token.FamilyID)
+	if err != nil {
+		log.Printf("Error revoking refresh tokens: %s", err)
+		http.Error(w, "Unable to revoke the refresh token", 500)
+		return
+	}
+
+	// respond with 204 code if all goes well
+	w.WriteHeader(204)
+}
+
+// lists the devices the user is logged in on
+func (cfg *apiConfig) sessionsHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := cfg.authenticate(w, r, scopeSessionOnly)
+	if !ok {
+		return
+	}
+	userID := c.userID
+
+	sessions, err := cfg.db.LoadSessions(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error loading sessions: %s", err)
+		http.Error(w, "Unable to load sessions", 500)
+		return
+	}
+
+	response := []responseSession{}
+	for _, s := range sessions {
+		session := responseSession{
+			Id:         s.FamilyID,
+			Created_at: s.SessionStartedAt,
+			Expires_at: s.ExpiresAt,
+			User_agent: s.UserAgent,
+			Ip_address: s.IpAddress,
+		}
+		if s.LastUsedAt.Valid {
+			session.Last_used_at = &s.LastUsedAt.Time
+		}
+		if s.ClientID.Valid {
+			session.Client_id = &s.ClientID.String
+			session.Client_name = &s.ClientName.String
+			session.Scopes = strings.Fields(s.Scopes)
+		}
+		response = append(response, session)
+	}
+
+	encodeJSON(w, response, 200)
+}
+
+// logs one device out, its access token stays valid until it expires
+func (cfg *apiConfig) revokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := cfg.authenticate(w, r, scopeSessionOnly)
+	if !ok {
+		return
+	}
+	userID := c.userID
+
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		http.Error(w, "Cannot find the session", 404)
+		return
+	}
+
+	// only matches the user's own live sessions
+	revoked, err := cfg.db.RevokeSession(r.Context(), database.RevokeSessionParams{
+		FamilyID: sessionID,
+		UserID:   userID,
+	})
+	if err != nil {
+		log.Printf("Error revoking session: %s", err)
+		http.Error(w, "Unable to revoke session", 500)
+		return
+	}
+
+	if revoked == 0 {
+		http.Error(w, "Cannot find the session", 404)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// logs every device out, including the one making the request
+func (cfg *apiConfig) logoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := cfg.authenticate(w, r, scopeSessionOnly)
+	if !ok {
+		return
+	}
+	userID := c.userID
+
+	err := cfg.db.RevokeAllSessions(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error revoking sessions: %s", err)
+		http.Error(w, "Unable to log out", 500)
+		return
+	}
+
+	w.WriteHeader(204)
+}
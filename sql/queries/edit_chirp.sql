@@ -0,0 +1,13 @@
+-- name: EditChirp :one
+-- the current body is copied into chirp_revisions before it gets replaced
+WITH revision AS (
+    INSERT INTO chirp_revisions (id, chirp_id, body, created_at, replaced_at)
+    SELECT gen_random_uuid(), chirps.id, chirps.body, chirps.updated_at, NOW()
+    FROM chirps
+    WHERE chirps.id = sqlc.arg('id')
+)
+UPDATE chirps
+SET body = sqlc.arg('body'),
+    updated_at = NOW()
+WHERE id = sqlc.arg('id')
+RETURNING *;
@@ -0,0 +1,17 @@
+-- name: VerifyEmail :execrows
+-- no row when the address isn't (any longer) the user's email
+UPDATE users
+SET email_verified_at = COALESCE(email_verified_at, NOW()),
+    updated_at = NOW()
+WHERE id = $1
+AND email = $2;
+
+-- name: ConfirmPendingEmail :execrows
+-- swaps in the pending address, no row when the user has since asked for another one
+UPDATE users
+SET email = pending_email,
+    pending_email = NULL,
+    email_verified_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1
+AND pending_email = $2;
@@ -1,3 +0,0 @@
--- name: LoadChirpsByAuthor :many
-SELECT * FROM chirps
-WHERE user_id = $1;
\ No newline at end of file
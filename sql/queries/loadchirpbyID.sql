@@ -1,2 +1,13 @@
 -- name: LoadChirpByID :one
-SELECT * FROM chirps WHERE id = $1; 
\ No newline at end of file
+SELECT * FROM chirps WHERE id = $1; 
+
+-- name: LoadChirpDetail :one
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id,
+    chirps.in_reply_to, chirps.repost_of, chirps.repost_kind,
+    (SELECT COUNT(*) FROM chirp_likes WHERE chirp_likes.chirp_id = chirps.id) AS like_count,
+    EXISTS (
+        SELECT 1 FROM chirp_likes
+        WHERE chirp_likes.chirp_id = chirps.id AND chirp_likes.user_id = sqlc.narg('viewer_id')::uuid
+    ) AS liked_by_me
+FROM chirps
+WHERE chirps.id = sqlc.arg('id');
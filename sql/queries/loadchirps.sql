@@ -1,2 +0,0 @@
--- name: LoadChirps :many
-SELECT * FROM chirps;
\ No newline at end of file
@@ -1,3 +1,10 @@
 -- name: Login :one
 
-SELECT * FROM users WHERE email = $1;
\ No newline at end of file
+SELECT * FROM users WHERE email = $1;
+
+-- name: RehashPassword :exec
+-- swaps in an upgraded hash of the same password, unless the password changed in the meantime
+UPDATE users
+SET hashed_password = sqlc.arg('new_hash')
+WHERE id = sqlc.arg('id')
+AND hashed_password = sqlc.arg('old_hash');
@@ -0,0 +1,39 @@
+-- name: LoadLoginLocks :many
+-- the locks still in effect for any of the keys
+SELECT locked_until FROM login_throttles
+WHERE key = ANY(sqlc.arg('keys')::text[])
+AND locked_until > NOW();
+
+-- name: CountLoginAttempt :execrows
+-- counts an attempt before its password is checked, in one statement so parallel guesses can't all get in under the limit.
+-- the attempt that goes over free_failures is let through but locks the key for lock_seconds, doubling with every
+-- further attempt up to max_lock_seconds. a locked key changes no row and the attempt isn't counted.
+-- a quiet period of reset_after_seconds starts the count over
+INSERT INTO login_throttles (key, failures, last_failure_at)
+VALUES (sqlc.arg('key'), 1, NOW())
+ON CONFLICT (key) DO UPDATE
+SET (failures, last_failure_at, locked_until) = (
+    SELECT counted.failures, NOW(), CASE
+        WHEN counted.failures > sqlc.arg('free_failures')::int THEN NOW() + make_interval(secs => LEAST(
+            sqlc.arg('lock_seconds')::float8 * power(2, LEAST(counted.failures - sqlc.arg('free_failures')::int - 1, 30)),
+            sqlc.arg('max_lock_seconds')::float8
+        ))
+    END
+    FROM (
+        SELECT CASE
+            WHEN login_throttles.last_failure_at < NOW() - make_interval(secs => sqlc.arg('reset_after_seconds')::float8) THEN 1
+            ELSE login_throttles.failures + 1
+        END AS failures
+    ) AS counted
+)
+WHERE login_throttles.locked_until IS NULL OR login_throttles.locked_until <= NOW();
+
+-- name: UncountLoginAttempt :exec
+-- takes back an attempt that turned out not to be a failure
+UPDATE login_throttles
+SET failures = GREATEST(failures - 1, 0)
+WHERE key = $1;
+
+-- name: ClearLoginFailures :exec
+DELETE FROM login_throttles
+WHERE key = $1;
@@ -0,0 +1,26 @@
+-- name: CreateMagicLink :exec
+INSERT INTO magic_links (token_hash, user_id, nonce_hash, created_at, expires_at)
+VALUES (
+    sqlc.arg('token_hash'),
+    sqlc.arg('user_id'),
+    sqlc.arg('nonce_hash'),
+    NOW(),
+    NOW() + make_interval(secs => sqlc.arg('ttl_seconds')::float8)
+);
+
+-- name: CountLiveMagicLinks :one
+-- links the user could still log in with, to cap how many emails one address gets
+SELECT COUNT(*) FROM magic_links
+WHERE user_id = $1
+AND used_at IS NULL
+AND expires_at > NOW();
+
+-- name: UseMagicLink :one
+-- marks a live link used and returns its user, no row for unknown, expired or used links or another nonce
+UPDATE magic_links
+SET used_at = NOW()
+WHERE token_hash = $1
+AND nonce_hash = $2
+AND used_at IS NULL
+AND expires_at > NOW()
+RETURNING user_id;
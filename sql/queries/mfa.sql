@@ -0,0 +1,65 @@
+-- name: SetTOTPSecret :exec
+-- a new, not yet enabled secret, replaces an earlier unfinished enrollment
+UPDATE users
+SET totp_secret = $2,
+    totp_enabled_at = NULL,
+    totp_last_step = 0,
+    updated_at = NOW()
+WHERE id = $1
+AND totp_enabled_at IS NULL;
+
+-- name: EnableTOTP :execrows
+UPDATE users
+SET totp_enabled_at = NOW(),
+    totp_last_step = $2,
+    updated_at = NOW()
+WHERE id = $1
+AND totp_secret IS NOT NULL
+AND totp_enabled_at IS NULL;
+
+-- name: DisableTOTP :exec
+UPDATE users
+SET totp_secret = NULL,
+    totp_enabled_at = NULL,
+    totp_last_step = 0,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: UseTOTPStep :execrows
+-- no row when a code of this or a later step was already used
+UPDATE users
+SET totp_last_step = $2
+WHERE id = $1
+AND totp_last_step < $2;
+
+-- name: CreateRecoveryCodes :exec
+INSERT INTO mfa_recovery_codes (user_id, code_hash, created_at)
+SELECT sqlc.arg('user_id')::uuid, UNNEST(sqlc.arg('code_hashes')::text[]), NOW();
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM mfa_recovery_codes
+WHERE user_id = $1;
+
+-- name: UseRecoveryCode :execrows
+UPDATE mfa_recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1
+AND code_hash = $2
+AND used_at IS NULL;
+
+-- name: RecordMFAFailure :exec
+-- every maxAttempts failures in a row lock the second factor for a while
+UPDATE users
+SET mfa_failed_attempts = mfa_failed_attempts + 1,
+    mfa_locked_until = CASE
+        WHEN (mfa_failed_attempts + 1) % sqlc.arg('max_attempts')::int = 0
+        THEN NOW() + make_interval(secs => sqlc.arg('lock_seconds')::float8)
+        ELSE mfa_locked_until
+    END
+WHERE id = sqlc.arg('id');
+
+-- name: ResetMFAFailures :exec
+UPDATE users
+SET mfa_failed_attempts = 0,
+    mfa_locked_until = NULL
+WHERE id = $1;
@@ -0,0 +1,58 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, secret_hash, name, redirect_uris, owner_id, created_at)
+VALUES (
+    sqlc.arg('id'),
+    sqlc.narg('secret_hash'),
+    sqlc.arg('name'),
+    sqlc.arg('redirect_uris'),
+    sqlc.arg('owner_id'),
+    NOW()
+)
+RETURNING *;
+
+-- name: FindOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE id = $1;
+
+-- name: LoadOAuthClients :many
+SELECT * FROM oauth_clients
+WHERE owner_id = $1
+ORDER BY created_at DESC, id;
+
+-- name: DeleteOAuthClient :execrows
+-- its codes and refresh tokens go with it
+DELETE FROM oauth_clients
+WHERE id = $1
+AND owner_id = $2;
+
+-- name: CreateAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, created_at, expires_at)
+VALUES (
+    sqlc.arg('code_hash'),
+    sqlc.arg('client_id'),
+    sqlc.arg('user_id'),
+    sqlc.arg('redirect_uri'),
+    sqlc.arg('scopes'),
+    sqlc.arg('code_challenge'),
+    NOW(),
+    NOW() + make_interval(secs => sqlc.arg('ttl_seconds')::float8)
+);
+
+-- name: FindAuthorizationCode :one
+-- a code whether it's live, expired or used, so a replay can be told apart from a made up code
+SELECT * FROM oauth_authorization_codes
+WHERE code_hash = $1;
+
+-- name: UseAuthorizationCode :one
+-- marks a live code used and returns it, no row for unknown, expired or used codes
+UPDATE oauth_authorization_codes
+SET used_at = NOW()
+WHERE code_hash = $1
+AND used_at IS NULL
+AND expires_at > NOW()
+RETURNING *;
+
+-- name: SetAuthorizationCodeFamily :exec
+UPDATE oauth_authorization_codes
+SET family_id = $2
+WHERE code_hash = $1;
@@ -0,0 +1,32 @@
+-- name: CreatePasswordResetToken :exec
+INSERT INTO password_reset_tokens (token_hash, user_id, created_at, expires_at)
+VALUES (
+    sqlc.arg('token_hash'),
+    sqlc.arg('user_id'),
+    NOW(),
+    NOW() + make_interval(secs => sqlc.arg('ttl_seconds')::float8)
+);
+
+-- name: UsePasswordResetToken :one
+-- marks a live token used and returns its user, no row for unknown, expired or used tokens
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE token_hash = $1
+AND used_at IS NULL
+AND expires_at > NOW()
+RETURNING user_id;
+
+-- name: ExpirePasswordResetTokens :exec
+-- once the password changed, older reset emails stop working too
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE user_id = $1
+AND used_at IS NULL;
+
+-- name: FindPasswordResetEmail :one
+-- the email of a live token's user, without using the token up
+SELECT users.email FROM password_reset_tokens
+JOIN users ON users.id = password_reset_tokens.user_id
+WHERE password_reset_tokens.token_hash = $1
+AND password_reset_tokens.used_at IS NULL
+AND password_reset_tokens.expires_at > NOW();
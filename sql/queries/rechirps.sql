@@ -0,0 +1,19 @@
+-- name: FindRechirp :one
+SELECT * FROM chirps
+WHERE user_id = $1 AND repost_of = $2 AND repost_kind = 'rechirp';
+
+-- name: DeleteRechirp :execrows
+DELETE FROM chirps
+WHERE user_id = $1 AND repost_of = $2 AND repost_kind = 'rechirp';
+
+-- name: LoadChirpsByIDs :many
+-- used to embed the originals of rechirps and quotes, one query per page
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id,
+    chirps.in_reply_to, chirps.repost_of, chirps.repost_kind,
+    (SELECT COUNT(*) FROM chirp_likes WHERE chirp_likes.chirp_id = chirps.id) AS like_count,
+    EXISTS (
+        SELECT 1 FROM chirp_likes
+        WHERE chirp_likes.chirp_id = chirps.id AND chirp_likes.user_id = sqlc.narg('viewer_id')::uuid
+    ) AS liked_by_me
+FROM chirps
+WHERE chirps.id = ANY(sqlc.arg('ids')::uuid[]);
@@ -1,10 +1,36 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, family_id, expires_at, session_started_at, user_agent, ip_address, client_id, scopes)
 VALUES (
-    $1,
+    sqlc.arg('token_hash'),
     NOW(),
     NOW(),
-    $2,
-    NOW() + INTERVAL '60 days'    
+    sqlc.arg('user_id'),
+    sqlc.arg('family_id'),
+    NOW() + make_interval(secs => sqlc.arg('ttl_seconds')::float8),
+    NOW(),
+    sqlc.arg('user_agent'),
+    sqlc.arg('ip_address'),
+    sqlc.narg('client_id'),
+    sqlc.arg('scopes')
+)
+RETURNING *;
+
+-- name: RotateRefreshToken :one
+-- retires a live token and issues its successor in the same family, in one statement
+-- no row means the old token is unknown, expired, already retired or issued to another client
+-- (client_id NULL for login refresh tokens)
+WITH retired AS (
+    UPDATE refresh_tokens
+    SET updated_at = NOW(),
+        revoked_at = NOW()
+    WHERE token_hash = sqlc.arg('old_token_hash')
+    AND revoked_at IS NULL
+    AND expires_at > NOW()
+    AND client_id IS NOT DISTINCT FROM sqlc.narg('client_id')
+    RETURNING user_id, family_id, session_started_at, user_agent, ip_address, client_id, scopes
 )
-RETURNING *;
\ No newline at end of file
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, family_id, expires_at, session_started_at, user_agent, ip_address, last_used_at, client_id, scopes)
+SELECT sqlc.arg('new_token_hash'), NOW(), NOW(), retired.user_id, retired.family_id, NOW() + make_interval(secs => sqlc.arg('ttl_seconds')::float8),
+    retired.session_started_at, retired.user_agent, retired.ip_address, NOW(), retired.client_id, retired.scopes
+FROM retired
+RETURNING *;
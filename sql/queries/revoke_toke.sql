@@ -1,7 +1,8 @@
--- name: RevokeToken :exec
+-- name: RevokeTokenFamily :exec
+-- ends a login: revokes every token that is still live in the family
 
 UPDATE refresh_tokens
 SET updated_at = NOW(),
-    revoked_at = NOW(),
-    token = 'revoked'
-WHERE token = $1;
\ No newline at end of file
+    revoked_at = NOW()
+WHERE family_id = $1
+AND revoked_at IS NULL;
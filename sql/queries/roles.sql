@@ -0,0 +1,10 @@
+-- name: FindUserRole :one
+SELECT role FROM users
+WHERE id = $1;
+
+-- name: UpdateUserRole :one
+UPDATE users
+SET role = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING *;
@@ -0,0 +1,27 @@
+-- name: LoadSessions :many
+-- the live token of every family is the session, rotated tokens are revoked so there's one per family
+-- sessions of OAuth clients come with the client's name
+SELECT refresh_tokens.family_id, refresh_tokens.session_started_at, refresh_tokens.last_used_at,
+    refresh_tokens.user_agent, refresh_tokens.ip_address, refresh_tokens.expires_at,
+    refresh_tokens.client_id, oauth_clients.name AS client_name, refresh_tokens.scopes
+FROM refresh_tokens
+LEFT JOIN oauth_clients ON oauth_clients.id = refresh_tokens.client_id
+WHERE refresh_tokens.user_id = $1
+AND refresh_tokens.revoked_at IS NULL
+AND refresh_tokens.expires_at > NOW()
+ORDER BY COALESCE(refresh_tokens.last_used_at, refresh_tokens.session_started_at) DESC, refresh_tokens.family_id;
+
+-- name: RevokeSession :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(),
+    revoked_at = NOW()
+WHERE family_id = $1
+AND user_id = $2
+AND revoked_at IS NULL;
+
+-- name: RevokeAllSessions :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(),
+    revoked_at = NOW()
+WHERE user_id = $1
+AND revoked_at IS NULL;
@@ -0,0 +1,20 @@
+-- name: LoadTimeline :many
+-- chirps by the user and everyone they follow, newest first
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id,
+    chirps.in_reply_to, chirps.repost_of, chirps.repost_kind,
+    (SELECT COUNT(*) FROM chirp_likes WHERE chirp_likes.chirp_id = chirps.id) AS like_count,
+    EXISTS (
+        SELECT 1 FROM chirp_likes
+        WHERE chirp_likes.chirp_id = chirps.id AND chirp_likes.user_id = sqlc.arg('user_id')
+    ) AS liked_by_me
+FROM chirps
+WHERE (
+    chirps.user_id = sqlc.arg('user_id')
+    OR chirps.user_id IN (SELECT follows.followee_id FROM follows WHERE follows.follower_id = sqlc.arg('user_id'))
+)
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('page_limit');
@@ -1,7 +1,13 @@
--- name: UpdateUser :exec
+-- name: UpdateUser :one
+-- fields left NULL keep their current value, a new email address waits in pending_email until it's verified
 
 UPDATE users
-SET email = $1,
-    hashed_password = $2,
+SET pending_email = COALESCE(sqlc.narg('pending_email'), pending_email),
+    hashed_password = COALESCE(sqlc.narg('hashed_password'), hashed_password),
+    username = COALESCE(sqlc.narg('username'), username),
+    display_name = COALESCE(sqlc.narg('display_name'), display_name),
+    bio = COALESCE(sqlc.narg('bio'), bio),
+    avatar_url = COALESCE(sqlc.narg('avatar_url'), avatar_url),
     updated_at = NOW()
-WHERE id = $3;
\ No newline at end of file
+WHERE id = sqlc.arg('id')
+RETURNING *;
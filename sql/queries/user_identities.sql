@@ -0,0 +1,62 @@
+-- name: CreateOIDCLogin :exec
+INSERT INTO oidc_logins (state_hash, nonce, code_verifier, created_at, expires_at)
+VALUES (
+    sqlc.arg('state_hash'),
+    sqlc.arg('nonce'),
+    sqlc.arg('code_verifier'),
+    NOW(),
+    NOW() + make_interval(secs => sqlc.arg('ttl_seconds')::float8)
+);
+
+-- name: UseOIDCLogin :one
+-- a sign-in can only come back once, no row when it's unknown, used or expired
+DELETE FROM oidc_logins
+WHERE state_hash = $1
+AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteExpiredOIDCLogins :exec
+-- sign-ins that never came back
+DELETE FROM oidc_logins
+WHERE expires_at <= NOW();
+
+-- name: FindUserByIdentity :one
+SELECT * FROM users
+WHERE id = (
+    SELECT user_id FROM user_identities
+    WHERE issuer = $1
+    AND subject = $2
+);
+
+-- name: CreateUserIdentity :exec
+INSERT INTO user_identities (id, user_id, issuer, subject, email, created_at, last_login_at)
+VALUES (
+    gen_random_uuid(),
+    sqlc.arg('user_id'),
+    sqlc.arg('issuer'),
+    sqlc.arg('subject'),
+    sqlc.narg('email'),
+    NOW(),
+    NOW()
+);
+
+-- name: TouchUserIdentity :exec
+UPDATE user_identities
+SET last_login_at = NOW(),
+    email = sqlc.narg('email')
+WHERE issuer = sqlc.arg('issuer')
+AND subject = sqlc.arg('subject');
+
+-- name: CreateUserWithIdentity :one
+-- a user without a password (hashed_password keeps its default), signed up through the provider
+-- the provider vouched for the address, so it starts out verified
+WITH new_user AS (
+    INSERT INTO users (id, created_at, updated_at, email, username, email_verified_at)
+    VALUES (gen_random_uuid(), NOW(), NOW(), sqlc.arg('email'), sqlc.arg('username'), NOW())
+    RETURNING *
+), new_identity AS (
+    INSERT INTO user_identities (id, user_id, issuer, subject, email, created_at, last_login_at)
+    SELECT gen_random_uuid(), new_user.id, sqlc.arg('issuer'), sqlc.arg('subject'), new_user.email, NOW(), NOW()
+    FROM new_user
+)
+SELECT * FROM new_user;
@@ -0,0 +1,9 @@
+-- name: LoadUserProfile :one
+-- looks a user up by id or, case-insensitively, by username
+SELECT sqlc.embed(users),
+    (SELECT COUNT(*) FROM follows WHERE follows.followee_id = users.id) AS follower_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.follower_id = users.id) AS following_count,
+    (SELECT COUNT(*) FROM chirps WHERE chirps.user_id = users.id) AS chirp_count
+FROM users
+WHERE users.id = sqlc.narg('id')::uuid
+OR LOWER(users.username) = LOWER(sqlc.narg('username')::text);
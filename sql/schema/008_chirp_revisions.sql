@@ -0,0 +1,17 @@
+-- +goose Up
+-- every body a chirp had before it was edited
+CREATE TABLE chirp_revisions (
+    id UUID PRIMARY KEY,
+    chirp_id UUID NOT NULL,
+    FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+-- when this body was posted (the chirp's updated_at at that time)
+    created_at TIMESTAMP NOT NULL,
+-- when an edit replaced it
+    replaced_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX chirp_revisions_chirp_id_idx ON chirp_revisions (chirp_id, replaced_at);
+
+-- +goose Down
+DROP TABLE chirp_revisions;
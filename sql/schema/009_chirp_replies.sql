@@ -0,0 +1,12 @@
+-- +goose Up
+-- a reply outlives the chirp it replied to: deleting the parent turns its replies into top-level chirps
+ALTER TABLE chirps
+ADD COLUMN in_reply_to UUID NULL REFERENCES chirps(id) ON DELETE SET NULL;
+
+CREATE INDEX chirps_in_reply_to_idx ON chirps (in_reply_to);
+
+-- +goose Down
+DROP INDEX chirps_in_reply_to_idx;
+
+ALTER TABLE chirps
+DROP COLUMN in_reply_to;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- rechirps and quotes point at the chirp they repost
+-- when the original gets deleted repost_of becomes NULL while repost_kind stays, which marks the repost as a tombstone
+ALTER TABLE chirps
+ADD COLUMN repost_of UUID NULL REFERENCES chirps(id) ON DELETE SET NULL,
+ADD COLUMN repost_kind TEXT NULL CHECK (repost_kind IN ('rechirp', 'quote'));
+
+CREATE INDEX chirps_repost_of_idx ON chirps (repost_of);
+
+-- a user can rechirp a chirp only once
+CREATE UNIQUE INDEX chirps_one_rechirp_per_user_idx ON chirps (user_id, repost_of) WHERE repost_kind = 'rechirp';
+
+-- +goose Down
+DROP INDEX chirps_one_rechirp_per_user_idx;
+DROP INDEX chirps_repost_of_idx;
+
+ALTER TABLE chirps
+DROP COLUMN repost_kind,
+DROP COLUMN repost_of;
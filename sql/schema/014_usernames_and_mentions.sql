@@ -0,0 +1,27 @@
+-- +goose Up
+-- handles are unique regardless of case, @Alice and @alice are the same user
+ALTER TABLE users
+ADD COLUMN username TEXT NULL;
+
+CREATE UNIQUE INDEX users_username_lower_idx ON users (LOWER(username));
+
+-- resolved @handles, offsets are byte offsets into the chirp body (end exclusive)
+CREATE TABLE chirp_mentions (
+    chirp_id UUID NOT NULL,
+    FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    start_offset INTEGER NOT NULL,
+    end_offset INTEGER NOT NULL,
+    PRIMARY KEY (chirp_id, start_offset)
+);
+
+CREATE INDEX chirp_mentions_user_id_idx ON chirp_mentions (user_id, chirp_id);
+
+-- +goose Down
+DROP TABLE chirp_mentions;
+
+DROP INDEX users_username_lower_idx;
+
+ALTER TABLE users
+DROP COLUMN username;
@@ -0,0 +1,22 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN display_name TEXT NOT NULL DEFAULT '',
+ADD COLUMN bio TEXT NOT NULL DEFAULT '',
+ADD COLUMN avatar_url TEXT NOT NULL DEFAULT '';
+
+-- every profile needs a handle, users who never picked one get user_ plus part of their id
+UPDATE users
+SET username = 'user_' || SUBSTRING(REPLACE(id::text, '-', '') FROM 1 FOR 12)
+WHERE username IS NULL;
+
+ALTER TABLE users
+ALTER COLUMN username SET NOT NULL;
+
+-- +goose Down
+ALTER TABLE users
+ALTER COLUMN username DROP NOT NULL;
+
+ALTER TABLE users
+DROP COLUMN display_name,
+DROP COLUMN bio,
+DROP COLUMN avatar_url;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- every refresh token from the same login shares a family, rotating a token keeps the family
+ALTER TABLE refresh_tokens
+ADD COLUMN family_id UUID NULL;
+
+-- tokens from before rotation each get a family of their own
+UPDATE refresh_tokens
+SET family_id = gen_random_uuid();
+
+ALTER TABLE refresh_tokens
+ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+-- +goose Down
+DROP INDEX refresh_tokens_family_id_idx;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN family_id;
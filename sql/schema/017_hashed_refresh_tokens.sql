@@ -0,0 +1,18 @@
+-- +goose Up
+-- revoking used to overwrite the token with this placeholder, those rows are dead anyway
+DELETE FROM refresh_tokens
+WHERE token = 'revoked';
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token TO token_hash;
+
+-- existing tokens keep working, they are looked up by their digest from now on
+UPDATE refresh_tokens
+SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex');
+
+-- +goose Down
+-- digests can't be turned back into tokens, everyone has to log in again
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token_hash TO token;
@@ -0,0 +1,24 @@
+-- +goose Up
+-- a session is a token family, these describe the login that started it and are copied on every rotation
+ALTER TABLE refresh_tokens
+ADD COLUMN session_started_at TIMESTAMP NULL,
+ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+ADD COLUMN ip_address TEXT NOT NULL DEFAULT '',
+ADD COLUMN last_used_at TIMESTAMP NULL;
+
+UPDATE refresh_tokens
+SET session_started_at = created_at;
+
+ALTER TABLE refresh_tokens
+ALTER COLUMN session_started_at SET NOT NULL;
+
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id) WHERE revoked_at IS NULL;
+
+-- +goose Down
+DROP INDEX refresh_tokens_user_id_idx;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN session_started_at,
+DROP COLUMN user_agent,
+DROP COLUMN ip_address,
+DROP COLUMN last_used_at;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- accounts from before verification existed start out unverified
+-- a changed address waits in pending_email until it is verified, email stays the login until then
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMP NULL,
+ADD COLUMN pending_email TEXT NULL;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN email_verified_at,
+DROP COLUMN pending_email;
@@ -0,0 +1,28 @@
+-- +goose Up
+-- totp_secret is encrypted (AES-GCM), it is set on enrollment and only counts once totp_enabled_at is set
+-- totp_last_step is the last time step a code was accepted for, so codes can't be replayed
+ALTER TABLE users
+ADD COLUMN totp_secret BYTEA NULL,
+ADD COLUMN totp_enabled_at TIMESTAMP NULL,
+ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN mfa_failed_attempts INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN mfa_locked_until TIMESTAMP NULL;
+
+CREATE TABLE mfa_recovery_codes (
+    user_id UUID NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+-- +goose Down
+DROP TABLE mfa_recovery_codes;
+
+ALTER TABLE users
+DROP COLUMN totp_secret,
+DROP COLUMN totp_enabled_at,
+DROP COLUMN totp_last_step,
+DROP COLUMN mfa_failed_attempts,
+DROP COLUMN mfa_locked_until;
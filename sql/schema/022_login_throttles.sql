@@ -0,0 +1,12 @@
+-- +goose Up
+-- failed logins per key, "email:<address>" or "ip:<address>"
+-- rows exist for unknown emails too, so a lock doesn't tell whether an account exists
+CREATE TABLE login_throttles (
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP NULL
+);
+
+-- +goose Down
+DROP TABLE login_throttles;
@@ -0,0 +1,41 @@
+-- +goose Up
+-- apps that act on behalf of users, registered by a user (owner_id)
+-- public clients (apps that can't keep a secret) have no secret_hash and rely on PKCE alone
+-- redirect_uris is a space separated list, a redirect has to match one exactly
+CREATE TABLE oauth_clients (
+    id TEXT PRIMARY KEY,
+    secret_hash TEXT NULL,
+    name TEXT NOT NULL,
+    redirect_uris TEXT NOT NULL,
+    owner_id UUID NOT NULL,
+    FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE oauth_authorization_codes (
+    code_hash TEXT PRIMARY KEY,
+    client_id TEXT NOT NULL,
+    FOREIGN KEY (client_id) REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+    code_challenge TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL
+);
+
+-- refresh tokens issued to a client, a token family is one authorization of the app
+-- login refresh tokens have no client and an empty scopes (everything)
+ALTER TABLE refresh_tokens
+ADD COLUMN client_id TEXT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+ADD COLUMN scopes TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN client_id,
+DROP COLUMN scopes;
+
+DROP TABLE oauth_authorization_codes;
+DROP TABLE oauth_clients;
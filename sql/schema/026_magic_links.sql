@@ -0,0 +1,17 @@
+-- +goose Up
+-- single-use login links, stored as the sha256 digest of the signed token in the link
+-- nonce_hash is the digest of the nonce the requesting browser got, the link only works together with it
+CREATE TABLE magic_links (
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    nonce_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL
+);
+
+CREATE INDEX magic_links_user_id_idx ON magic_links (user_id);
+
+-- +goose Down
+DROP TABLE magic_links;
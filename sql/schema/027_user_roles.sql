@@ -0,0 +1,8 @@
+-- +goose Up
+-- moderators can delete any chirp, admins can also use /admin/* and change roles
+ALTER TABLE users
+ADD COLUMN role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator', 'admin'));
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN role;
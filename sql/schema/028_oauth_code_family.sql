@@ -0,0 +1,8 @@
+-- +goose Up
+-- the token family an authorization code was exchanged for, revoked when the code is replayed
+ALTER TABLE oauth_authorization_codes
+ADD COLUMN family_id UUID NULL;
+
+-- +goose Down
+ALTER TABLE oauth_authorization_codes
+DROP COLUMN family_id;
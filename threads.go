@@ -0,0 +1,129 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/peethree/chirpy/internal/database"
+)
+
+// reply levels returned by default, the most a client may ask for, and the cap on returned replies
+const (
+	defaultThreadDepth = 3
+	maxThreadDepth     = 10
+	maxThreadReplies   = 500
+	// a reply chain longer than this is cut off at the top
+	maxThreadAncestors = 100
+)
+
+// a chirp with its replies nested underneath
+type responseThreadNode struct {
+	responseChirp
+	Replies []*responseThreadNode `json:"replies"`
+}
+
+// struct for responding to api/chirps/{chirpID}/thread
+type responseThread struct {
+	// from the root of the thread down to the direct parent
+	Ancestors []responseChirp     `json:"ancestors"`
+	Chirp     *responseThreadNode `json:"chirp"`
+	// true when there were more replies than maxThreadReplies
+	Truncated bool `json:"truncated"`
+}
+
+// loads the conversation around a chirp in one call
+func (cfg *apiConfig) chirpThreadHandler(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		http.Error(w, "Can't find this chirp", 404)
+		return
+	}
+
+	depth := defaultThreadDepth
+	if queryDepth := r.URL.Query().Get("depth"); queryDepth != "" {
+		depth, err = strconv.Atoi(queryDepth)
+		if err != nil || depth < 0 || depth > maxThreadDepth {
+			http.Error(w, "depth must be between 0 and 10", 400)
+			return
+		}
+	}
+
+	viewer := cfg.optionalViewer(r)
+
+	chirp, err := cfg.db.LoadChirpDetail(r.Context(), database.LoadChirpDetailParams{
+		ViewerID: viewer,
+		ID:       chirpID,
+	})
+	if err != nil {
+		http.Error(w, "Can't find this chirp", 404)
+		return
+	}
+
+	ancestors, err := cfg.db.LoadChirpAncestors(r.Context(), database.LoadChirpAncestorsParams{
+		ChirpID:  chirpID,
+		MaxDepth: maxThreadAncestors,
+		ViewerID: viewer,
+	})
+	if err != nil {
+		log.Printf("Error loading thread ancestors: %s", err)
+		http.Error(w, "Can't load thread", 500)
+		return
+	}
+
+	var descendants []database.LoadChirpDescendantsRow
+	if depth > 0 {
+		// one extra row to find out whether replies were cut off
+		descendants, err = cfg.db.LoadChirpDescendants(r.Context(), database.LoadChirpDescendantsParams{
+			ChirpID:   chirpID,
+			MaxDepth:  int32(depth),
+			ViewerID:  viewer,
+			MaxChirps: maxThreadReplies + 1,
+		})
+		if err != nil {
+			log.Printf("Error loading thread replies: %s", err)
+			http.Error(w, "Can't load thread", 500)
+			return
+		}
+	}
+
+	response := responseThread{
+		Ancestors: []responseChirp{},
+		Chirp:     &responseThreadNode{responseChirp: likedChirpResponse(loadedChirp(chirp), viewer), Replies: []*responseThreadNode{}},
+	}
+
+	for _, ancestor := range ancestors {
+		response.Ancestors = append(response.Ancestors, likedChirpResponse(loadedChirp(ancestor), viewer))
+	}
+
+	if len(descendants) > maxThreadReplies {
+		descendants = descendants[:maxThreadReplies]
+		response.Truncated = true
+	}
+
+	// every chirp in the thread, to embed the originals of rechirps and quotes in one go
+	refs := append(chirpRefs(response.Ancestors), &response.Chirp.responseChirp)
+
+	// parents always come before their replies, so every reply finds its parent already in the map
+	nodes := map[uuid.UUID]*responseThreadNode{chirp.ID: response.Chirp}
+	for _, descendant := range descendants {
+		parent, ok := nodes[descendant.InReplyTo.UUID]
+		if !ok {
+			continue
+		}
+		node := &responseThreadNode{responseChirp: likedChirpResponse(loadedChirp(descendant), viewer), Replies: []*responseThreadNode{}}
+		parent.Replies = append(parent.Replies, node)
+		nodes[descendant.ID] = node
+		refs = append(refs, &node.responseChirp)
+	}
+
+	err = cfg.hydrateChirps(r.Context(), refs, viewer)
+	if err != nil {
+		log.Printf("Error loading original chirps: %s", err)
+		http.Error(w, "Can't load thread", 500)
+		return
+	}
+
+	encodeJSON(w, response, 200)
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/peethree/chirpy/internal/auth"
+	"github.com/peethree/chirpy/internal/database"
+)
+
+// scopes a personal access token can be given, login sessions may do everything
+const (
+	scopeChirpsWrite  = "chirps:write"
+	scopeChirpsDelete = "chirps:delete"
+	scopeLikesWrite   = "likes:write"
+	scopeFollowsWrite = "follows:write"
+	scopeTimelineRead = "timeline:read"
+	scopeProfileWrite = "profile:write"
+	// not a grantable scope: endpoints that need a login session (tokens, sessions, two-factor settings)
+	scopeSessionOnly = ""
+)
+
+var tokenScopes = []string{
+	scopeChirpsWrite,
+	scopeChirpsDelete,
+	scopeLikesWrite,
+	scopeFollowsWrite,
+	scopeTimelineRead,
+	scopeProfileWrite,
+}
+
+const (
+	maxTokenNameLength = 100
+	// personal access tokens can be made to expire after up to a year, or never
+	maxTokenExpiryDays = 365
+)
+
+var (
+	errNoBearerToken = errors.New("no bearer token")
+	errInvalidToken  = errors.New("invalid, expired or revoked token")
+)
+
+// who a request was made by: a login session's access token, a personal access token or an OAuth client's access token
+type caller struct {
+	userID uuid.UUID
+	// personal access tokens and OAuth clients are limited to scopes, login sessions are not
+	scoped bool
+	scopes []string
+	// from the access token of a login session, empty for regular users
+	role string
+}
+
+// struct for creating a token on POST api/tokens
+type requestToken struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// optional, the token never expires without it
+	Expires_in_days *int `json:"expires_in_days"`
+}
+
+// struct for responding with a personal access token, Token is only set right after creating it
+type responseToken struct {
+	Id           uuid.UUID  `json:"id"`
+	Name         string     `json:"name"`
+	Scopes       []string   `json:"scopes"`
+	Created_at   time.Time  `json:"created_at"`
+	Expires_at   *time.Time `json:"expires_at"`
+	Last_used_at *time.Time `json:"last_used_at"`
+	Token        string     `json:"token,omitempty"`
+}
+
+func tokenResponse(token database.PersonalAccessToken) responseToken {
+	response := responseToken{
+		Id:         token.ID,
+		Name:       token.Name,
+		Scopes:     strings.Fields(token.Scopes),
+		Created_at: token.CreatedAt,
+	}
+	if token.ExpiresAt.Valid {
+		response.Expires_at = &token.ExpiresAt.Time
+	}
+	if token.LastUsedAt.Valid {
+		response.Last_used_at = &token.LastUsedAt.Time
+	}
+	return response
+}
+
+// whether the caller may use an endpoint that needs scope
+func (c caller) allows(scope string) bool {
+	if !c.scoped {
+		return true
+	}
+	if scope == scopeSessionOnly {
+		return false
+	}
+	return slices.Contains(c.scopes, scope)
+}
+
+// looks up the caller from the bearer token, either an access token (JWT) or a personal access token
+func (cfg *apiConfig) identify(r *http.Request) (caller, error) {
+	bearerToken, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return caller{}, errNoBearerToken
+	}
+
+	if auth.IsPersonalAccessToken(bearerToken) {
+		token, err := cfg.db.UsePersonalAccessToken(r.Context(), auth.HashRefreshToken(bearerToken))
+		if errors.Is(err, sql.ErrNoRows) {
+			return caller{}, errInvalidToken
+		}
+		if err != nil {
+			return caller{}, err
+		}
+		return caller{userID: token.UserID, scoped: true, scopes: strings.Fields(token.Scopes)}, nil
+	}
+
+	claims, err := cfg.keys.ValidateAccessToken(bearerToken)
+	if err != nil {
+		return caller{}, fmt.Errorf("%w: %s", errInvalidToken, err)
+	}
+
+	// ValidateAccessToken made sure the subject is a uuid
+	c := caller{userID: uuid.MustParse(claims.Subject), role: claims.Role}
+	if claims.ClientID != "" {
+		c.scoped = true
+		c.scopes = strings.Fields(claims.Scope)
+	}
+
+	return c, nil
+}
+
+// the caller of an endpoint that needs scope, writes the error response itself and returns false
+// when there is no usable bearer token (401) or the token lacks the scope (403)
+func (cfg *apiConfig) authenticate(w http.ResponseWriter, r *http.Request, scope string) (caller, bool) {
+	c, err := cfg.identify(r)
+	if errors.Is(err, errNoBearerToken) {
+		http.Error(w, "auth bearer token required", http.StatusUnauthorized)
+		return caller{}, false
+	}
+	if errors.Is(err, errInvalidToken) {
+		http.Error(w, "user does not have a valid access token", http.StatusUnauthorized)
+		return caller{}, false
+	}
+	if err != nil {
+		log.Printf("Error looking up personal access token: %s", err)
+		http.Error(w, "Unable to check access token", 500)
+		return caller{}, false
+	}
+
+	if !c.allows(scope) {
+		if scope == scopeSessionOnly {
+			http.Error(w, "Personal access tokens can't be used here, log in instead", http.StatusForbidden)
+		} else {
+			http.Error(w, fmt.Sprintf("Token is missing the %s scope", scope), http.StatusForbidden)
+		}
+		return caller{}, false
+	}
+
+	return c, true
+}
+
+// creates a personal access token, the token itself is only in this response
+func (cfg *apiConfig) createTokenHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := cfg.authenticate(w, r, scopeSessionOnly)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := requestToken{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		http.Error(w, "Invalid Json", 400)
+		return
+	}
+
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" || utf8.RuneCountInString(params.Name) > maxTokenNameLength {
+		http.Error(w, fmt.Sprintf("Token name must be 1 to %d characters", maxTokenNameLength), 400)
+		return
+	}
+
+	if len(params.Scopes) == 0 {
+		http.Error(w, "Token needs at least one scope", 400)
+		return
+	}
+	scopes := []string{}
+	for _, scope := range params.Scopes {
+		if !slices.Contains(tokenScopes, scope) {
+			http.Error(w, fmt.Sprintf("Unknown scope %q, scopes are: %s", scope, strings.Join(tokenScopes, ", ")), 400)
+			return
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	expiresAt := sql.NullTime{}
+	if params.Expires_in_days != nil {
+		days := *params.Expires_in_days
+		if days < 1 || days > maxTokenExpiryDays {
+			http.Error(w, fmt.Sprintf("expires_in_days must be 1 to %d, leave it out for a token that doesn't expire", maxTokenExpiryDays), 400)
+			return
+		}
+		expiresAt = sql.NullTime{Time: time.Now().UTC().AddDate(0, 0, days), Valid: true}
+	}
+
+	plainToken, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		log.Printf("Error making personal access token: %s", err)
+		http.Error(w, "Unable to make a token", 500)
+		return
+	}
+
+	token, err := cfg.db.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    c.userID,
+		Name:      params.Name,
+		TokenHash: auth.HashRefreshToken(plainToken),
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		log.Printf("Error storing personal access token: %s", err)
+		http.Error(w, "Unable to make a token", 500)
+		return
+	}
+
+	response := tokenResponse(token)
+	response.Token = plainToken
+
+	encodeJSON(w, response, 201)
+}
+
+// lists the user's live personal access tokens, without the tokens themselves
+func (cfg *apiConfig) tokensHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := cfg.authenticate(w, r, scopeSessionOnly)
+	if !ok {
+		return
+	}
+
+	tokens, err := cfg.db.LoadPersonalAccessTokens(r.Context(), c.userID)
+	if err != nil {
+		log.Printf("Error loading personal access tokens: %s", err)
+		http.Error(w, "Unable to load tokens", 500)
+		return
+	}
+
+	response := make([]responseToken, 0, len(tokens))
+	for _, token := range tokens {
+		response = append(response, tokenResponse(token))
+	}
+
+	encodeJSON(w, response, 200)
+}
+
+// revokes one of the user's personal access tokens
+func (cfg *apiConfig) revokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := cfg.authenticate(w, r, scopeSessionOnly)
+	if !ok {
+		return
+	}
+
+	tokenID, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		http.Error(w, "Unable to find token", 404)
+		return
+	}
+
+	revoked, err := cfg.db.RevokePersonalAccessToken(r.Context(), database.RevokePersonalAccessTokenParams{
+		ID:     tokenID,
+		UserID: c.userID,
+	})
+	if err != nil {
+		log.Printf("Error revoking personal access token: %s", err)
+		http.Error(w, "Unable to revoke token", 500)
+		return
+	}
+	// someone else's token looks the same as a missing one
+	if revoked == 0 {
+		http.Error(w, "Unable to find token", 404)
+		return
+	}
+
+	w.WriteHeader(204)
+}